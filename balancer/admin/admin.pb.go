@@ -0,0 +1,564 @@
+// Code generated by protoc-gen-go.
+// source: admin.proto
+// DO NOT EDIT!
+
+/*
+Package admin is a generated protocol buffer package.
+
+It is generated from these files:
+
+	admin.proto
+
+It has these top-level messages:
+
+	Backend
+	ListBackendsRequest
+	ListBackendsReply
+	BackendRequest
+	DrainRequest
+	SetWeightRequest
+	BackendReply
+	PoolWeight
+	SetSplitRequest
+	SetSplitReply
+	MirrorStatsRequest
+	CodeCount
+	MirrorStatsReply
+*/
+package admin
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type Backend struct {
+	Address  string `protobuf:"bytes,1,opt,name=address" json:"address,omitempty"`
+	Healthy  bool   `protobuf:"varint,2,opt,name=healthy" json:"healthy,omitempty"`
+	Ejected  bool   `protobuf:"varint,3,opt,name=ejected" json:"ejected,omitempty"`
+	Draining bool   `protobuf:"varint,4,opt,name=draining" json:"draining,omitempty"`
+	Weight   int32  `protobuf:"varint,5,opt,name=weight" json:"weight,omitempty"`
+	Pool     string `protobuf:"bytes,6,opt,name=pool" json:"pool,omitempty"`
+}
+
+func (m *Backend) Reset()                    { *m = Backend{} }
+func (m *Backend) String() string            { return proto.CompactTextString(m) }
+func (*Backend) ProtoMessage()               {}
+func (*Backend) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+type ListBackendsRequest struct {
+	// Every pool's backends are listed if empty
+	Pool string `protobuf:"bytes,1,opt,name=pool" json:"pool,omitempty"`
+}
+
+func (m *ListBackendsRequest) Reset()                    { *m = ListBackendsRequest{} }
+func (m *ListBackendsRequest) String() string            { return proto.CompactTextString(m) }
+func (*ListBackendsRequest) ProtoMessage()               {}
+func (*ListBackendsRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+type ListBackendsReply struct {
+	Backends []*Backend `protobuf:"bytes,1,rep,name=backends" json:"backends,omitempty"`
+}
+
+func (m *ListBackendsReply) Reset()                    { *m = ListBackendsReply{} }
+func (m *ListBackendsReply) String() string            { return proto.CompactTextString(m) }
+func (*ListBackendsReply) ProtoMessage()               {}
+func (*ListBackendsReply) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *ListBackendsReply) GetBackends() []*Backend {
+	if m != nil {
+		return m.Backends
+	}
+	return nil
+}
+
+type BackendRequest struct {
+	Address string `protobuf:"bytes,1,opt,name=address" json:"address,omitempty"`
+	Pool    string `protobuf:"bytes,2,opt,name=pool" json:"pool,omitempty"`
+}
+
+func (m *BackendRequest) Reset()                    { *m = BackendRequest{} }
+func (m *BackendRequest) String() string            { return proto.CompactTextString(m) }
+func (*BackendRequest) ProtoMessage()               {}
+func (*BackendRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+type DrainRequest struct {
+	Address string `protobuf:"bytes,1,opt,name=address" json:"address,omitempty"`
+	Resume  bool   `protobuf:"varint,2,opt,name=resume" json:"resume,omitempty"`
+	Pool    string `protobuf:"bytes,3,opt,name=pool" json:"pool,omitempty"`
+}
+
+func (m *DrainRequest) Reset()                    { *m = DrainRequest{} }
+func (m *DrainRequest) String() string            { return proto.CompactTextString(m) }
+func (*DrainRequest) ProtoMessage()               {}
+func (*DrainRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+type SetWeightRequest struct {
+	Address string `protobuf:"bytes,1,opt,name=address" json:"address,omitempty"`
+	Weight  int32  `protobuf:"varint,2,opt,name=weight" json:"weight,omitempty"`
+	Pool    string `protobuf:"bytes,3,opt,name=pool" json:"pool,omitempty"`
+}
+
+func (m *SetWeightRequest) Reset()                    { *m = SetWeightRequest{} }
+func (m *SetWeightRequest) String() string            { return proto.CompactTextString(m) }
+func (*SetWeightRequest) ProtoMessage()               {}
+func (*SetWeightRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+type BackendReply struct {
+	Backend *Backend `protobuf:"bytes,1,opt,name=backend" json:"backend,omitempty"`
+}
+
+func (m *BackendReply) Reset()                    { *m = BackendReply{} }
+func (m *BackendReply) String() string            { return proto.CompactTextString(m) }
+func (*BackendReply) ProtoMessage()               {}
+func (*BackendReply) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+func (m *BackendReply) GetBackend() *Backend {
+	if m != nil {
+		return m.Backend
+	}
+	return nil
+}
+
+type PoolWeight struct {
+	Pool   string `protobuf:"bytes,1,opt,name=pool" json:"pool,omitempty"`
+	Weight int32  `protobuf:"varint,2,opt,name=weight" json:"weight,omitempty"`
+}
+
+func (m *PoolWeight) Reset()                    { *m = PoolWeight{} }
+func (m *PoolWeight) String() string            { return proto.CompactTextString(m) }
+func (*PoolWeight) ProtoMessage()               {}
+func (*PoolWeight) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+type SetSplitRequest struct {
+	Route string `protobuf:"bytes,1,opt,name=route" json:"route,omitempty"`
+	// Pools of the split that aren't listed keep their weight
+	Weights []*PoolWeight `protobuf:"bytes,2,rep,name=weights" json:"weights,omitempty"`
+}
+
+func (m *SetSplitRequest) Reset()                    { *m = SetSplitRequest{} }
+func (m *SetSplitRequest) String() string            { return proto.CompactTextString(m) }
+func (*SetSplitRequest) ProtoMessage()               {}
+func (*SetSplitRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+
+func (m *SetSplitRequest) GetWeights() []*PoolWeight {
+	if m != nil {
+		return m.Weights
+	}
+	return nil
+}
+
+type SetSplitReply struct {
+	// Every pool of the split with its new weight
+	Weights []*PoolWeight `protobuf:"bytes,1,rep,name=weights" json:"weights,omitempty"`
+}
+
+func (m *SetSplitReply) Reset()                    { *m = SetSplitReply{} }
+func (m *SetSplitReply) String() string            { return proto.CompactTextString(m) }
+func (*SetSplitReply) ProtoMessage()               {}
+func (*SetSplitReply) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
+
+func (m *SetSplitReply) GetWeights() []*PoolWeight {
+	if m != nil {
+		return m.Weights
+	}
+	return nil
+}
+
+type MirrorStatsRequest struct {
+	Route string `protobuf:"bytes,1,opt,name=route" json:"route,omitempty"`
+}
+
+func (m *MirrorStatsRequest) Reset()                    { *m = MirrorStatsRequest{} }
+func (m *MirrorStatsRequest) String() string            { return proto.CompactTextString(m) }
+func (*MirrorStatsRequest) ProtoMessage()               {}
+func (*MirrorStatsRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
+
+type CodeCount struct {
+	// Status code name, e.g. "OK"
+	Code  string `protobuf:"bytes,1,opt,name=code" json:"code,omitempty"`
+	Count int64  `protobuf:"varint,2,opt,name=count" json:"count,omitempty"`
+}
+
+func (m *CodeCount) Reset()                    { *m = CodeCount{} }
+func (m *CodeCount) String() string            { return proto.CompactTextString(m) }
+func (*CodeCount) ProtoMessage()               {}
+func (*CodeCount) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
+
+type MirrorStatsReply struct {
+	Pool     string  `protobuf:"bytes,1,opt,name=pool" json:"pool,omitempty"`
+	Fraction float64 `protobuf:"fixed64,2,opt,name=fraction" json:"fraction,omitempty"`
+	// Requests answered by both pools since the config was last loaded
+	Compared int64 `protobuf:"varint,3,opt,name=compared" json:"compared,omitempty"`
+	// Of those, how many got a different status from the shadow pool
+	Mismatched int64 `protobuf:"varint,4,opt,name=mismatched" json:"mismatched,omitempty"`
+	// Status codes of the shadow pool's answers
+	Codes []*CodeCount `protobuf:"bytes,5,rep,name=codes" json:"codes,omitempty"`
+	// Average latencies of the compared requests
+	PrimaryLatencyUs int64 `protobuf:"varint,6,opt,name=primary_latency_us,json=primaryLatencyUs" json:"primary_latency_us,omitempty"`
+	ShadowLatencyUs  int64 `protobuf:"varint,7,opt,name=shadow_latency_us,json=shadowLatencyUs" json:"shadow_latency_us,omitempty"`
+}
+
+func (m *MirrorStatsReply) Reset()                    { *m = MirrorStatsReply{} }
+func (m *MirrorStatsReply) String() string            { return proto.CompactTextString(m) }
+func (*MirrorStatsReply) ProtoMessage()               {}
+func (*MirrorStatsReply) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{12} }
+
+func (m *MirrorStatsReply) GetCodes() []*CodeCount {
+	if m != nil {
+		return m.Codes
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*Backend)(nil), "admin.Backend")
+	proto.RegisterType((*ListBackendsRequest)(nil), "admin.ListBackendsRequest")
+	proto.RegisterType((*ListBackendsReply)(nil), "admin.ListBackendsReply")
+	proto.RegisterType((*BackendRequest)(nil), "admin.BackendRequest")
+	proto.RegisterType((*DrainRequest)(nil), "admin.DrainRequest")
+	proto.RegisterType((*SetWeightRequest)(nil), "admin.SetWeightRequest")
+	proto.RegisterType((*BackendReply)(nil), "admin.BackendReply")
+	proto.RegisterType((*PoolWeight)(nil), "admin.PoolWeight")
+	proto.RegisterType((*SetSplitRequest)(nil), "admin.SetSplitRequest")
+	proto.RegisterType((*SetSplitReply)(nil), "admin.SetSplitReply")
+	proto.RegisterType((*MirrorStatsRequest)(nil), "admin.MirrorStatsRequest")
+	proto.RegisterType((*CodeCount)(nil), "admin.CodeCount")
+	proto.RegisterType((*MirrorStatsReply)(nil), "admin.MirrorStatsReply")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion3
+
+// Client API for Admin service
+
+type AdminClient interface {
+	ListBackends(ctx context.Context, in *ListBackendsRequest, opts ...grpc.CallOption) (*ListBackendsReply, error)
+	AddBackend(ctx context.Context, in *BackendRequest, opts ...grpc.CallOption) (*BackendReply, error)
+	RemoveBackend(ctx context.Context, in *BackendRequest, opts ...grpc.CallOption) (*BackendReply, error)
+	// Stops sending new requests to a backend, or starts again if resume is set
+	DrainBackend(ctx context.Context, in *DrainRequest, opts ...grpc.CallOption) (*BackendReply, error)
+	SetWeight(ctx context.Context, in *SetWeightRequest, opts ...grpc.CallOption) (*BackendReply, error)
+	// Changes how a named route splits its requests between pools
+	SetSplit(ctx context.Context, in *SetSplitRequest, opts ...grpc.CallOption) (*SetSplitReply, error)
+	// How the shadow pool of a named route answers compared to its primary
+	MirrorStats(ctx context.Context, in *MirrorStatsRequest, opts ...grpc.CallOption) (*MirrorStatsReply, error)
+}
+
+type adminClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewAdminClient(cc *grpc.ClientConn) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) ListBackends(ctx context.Context, in *ListBackendsRequest, opts ...grpc.CallOption) (*ListBackendsReply, error) {
+	out := new(ListBackendsReply)
+	err := grpc.Invoke(ctx, "/admin.Admin/ListBackends", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) AddBackend(ctx context.Context, in *BackendRequest, opts ...grpc.CallOption) (*BackendReply, error) {
+	out := new(BackendReply)
+	err := grpc.Invoke(ctx, "/admin.Admin/AddBackend", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) RemoveBackend(ctx context.Context, in *BackendRequest, opts ...grpc.CallOption) (*BackendReply, error) {
+	out := new(BackendReply)
+	err := grpc.Invoke(ctx, "/admin.Admin/RemoveBackend", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) DrainBackend(ctx context.Context, in *DrainRequest, opts ...grpc.CallOption) (*BackendReply, error) {
+	out := new(BackendReply)
+	err := grpc.Invoke(ctx, "/admin.Admin/DrainBackend", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) SetWeight(ctx context.Context, in *SetWeightRequest, opts ...grpc.CallOption) (*BackendReply, error) {
+	out := new(BackendReply)
+	err := grpc.Invoke(ctx, "/admin.Admin/SetWeight", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) SetSplit(ctx context.Context, in *SetSplitRequest, opts ...grpc.CallOption) (*SetSplitReply, error) {
+	out := new(SetSplitReply)
+	err := grpc.Invoke(ctx, "/admin.Admin/SetSplit", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) MirrorStats(ctx context.Context, in *MirrorStatsRequest, opts ...grpc.CallOption) (*MirrorStatsReply, error) {
+	out := new(MirrorStatsReply)
+	err := grpc.Invoke(ctx, "/admin.Admin/MirrorStats", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for Admin service
+
+type AdminServer interface {
+	ListBackends(context.Context, *ListBackendsRequest) (*ListBackendsReply, error)
+	AddBackend(context.Context, *BackendRequest) (*BackendReply, error)
+	RemoveBackend(context.Context, *BackendRequest) (*BackendReply, error)
+	// Stops sending new requests to a backend, or starts again if resume is set
+	DrainBackend(context.Context, *DrainRequest) (*BackendReply, error)
+	SetWeight(context.Context, *SetWeightRequest) (*BackendReply, error)
+	// Changes how a named route splits its requests between pools
+	SetSplit(context.Context, *SetSplitRequest) (*SetSplitReply, error)
+	// How the shadow pool of a named route answers compared to its primary
+	MirrorStats(context.Context, *MirrorStatsRequest) (*MirrorStatsReply, error)
+}
+
+func RegisterAdminServer(s *grpc.Server, srv AdminServer) {
+	s.RegisterService(&_Admin_serviceDesc, srv)
+}
+
+func _Admin_ListBackends_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListBackendsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListBackends(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.Admin/ListBackends",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListBackends(ctx, req.(*ListBackendsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_AddBackend_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BackendRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).AddBackend(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.Admin/AddBackend",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).AddBackend(ctx, req.(*BackendRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_RemoveBackend_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BackendRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).RemoveBackend(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.Admin/RemoveBackend",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).RemoveBackend(ctx, req.(*BackendRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_DrainBackend_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DrainRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).DrainBackend(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.Admin/DrainBackend",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).DrainBackend(ctx, req.(*DrainRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_SetWeight_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetWeightRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).SetWeight(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.Admin/SetWeight",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).SetWeight(ctx, req.(*SetWeightRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_SetSplit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetSplitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).SetSplit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.Admin/SetSplit",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).SetSplit(ctx, req.(*SetSplitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_MirrorStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MirrorStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).MirrorStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.Admin/MirrorStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).MirrorStats(ctx, req.(*MirrorStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Admin_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "admin.Admin",
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListBackends",
+			Handler:    _Admin_ListBackends_Handler,
+		},
+		{
+			MethodName: "AddBackend",
+			Handler:    _Admin_AddBackend_Handler,
+		},
+		{
+			MethodName: "RemoveBackend",
+			Handler:    _Admin_RemoveBackend_Handler,
+		},
+		{
+			MethodName: "DrainBackend",
+			Handler:    _Admin_DrainBackend_Handler,
+		},
+		{
+			MethodName: "SetWeight",
+			Handler:    _Admin_SetWeight_Handler,
+		},
+		{
+			MethodName: "SetSplit",
+			Handler:    _Admin_SetSplit_Handler,
+		},
+		{
+			MethodName: "MirrorStats",
+			Handler:    _Admin_MirrorStats_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: fileDescriptor0,
+}
+
+func init() { proto.RegisterFile("admin.proto", fileDescriptor0) }
+
+var fileDescriptor0 = []byte{
+	// 618 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x55, 0xcb, 0x6e, 0xd3, 0x40,
+	0x14, 0xc5, 0x71, 0x9d, 0xa4, 0xb7, 0xaf, 0x74, 0x5a, 0x5a, 0xe3, 0x05, 0x8a, 0xbc, 0x40, 0x21,
+	0xa0, 0x2e, 0x8a, 0x90, 0xaa, 0xf2, 0x52, 0x09, 0x62, 0x55, 0x24, 0x34, 0x29, 0x2a, 0xbb, 0x6a,
+	0xea, 0x19, 0x1a, 0x83, 0xed, 0x31, 0x33, 0x13, 0xaa, 0xec, 0xf8, 0x13, 0x7e, 0x86, 0x0f, 0x43,
+	0x1e, 0x8f, 0x9d, 0xc9, 0x8b, 0x22, 0x76, 0xb9, 0xf7, 0x9c, 0x73, 0x1f, 0xc7, 0x73, 0x15, 0xd8,
+	0x20, 0x34, 0x8d, 0xb3, 0xa3, 0x5c, 0x70, 0xc5, 0x91, 0xa7, 0x83, 0xf0, 0x97, 0x03, 0xad, 0xb7,
+	0x24, 0xfa, 0xc6, 0x32, 0x8a, 0x7c, 0x68, 0x11, 0x4a, 0x05, 0x93, 0xd2, 0x77, 0xba, 0x4e, 0x6f,
+	0x1d, 0x57, 0x61, 0x81, 0x8c, 0x18, 0x49, 0xd4, 0x68, 0xe2, 0x37, 0xba, 0x4e, 0xaf, 0x8d, 0xab,
+	0xb0, 0x40, 0xd8, 0x57, 0x16, 0x29, 0x46, 0x7d, 0xb7, 0x44, 0x4c, 0x88, 0x02, 0x68, 0x53, 0x41,
+	0xe2, 0x2c, 0xce, 0x6e, 0xfc, 0x35, 0x0d, 0xd5, 0x31, 0x3a, 0x80, 0xe6, 0x2d, 0x8b, 0x6f, 0x46,
+	0xca, 0xf7, 0xba, 0x4e, 0xcf, 0xc3, 0x26, 0x42, 0x08, 0xd6, 0x72, 0xce, 0x13, 0xbf, 0xa9, 0xdb,
+	0xeb, 0xdf, 0xe1, 0x63, 0xd8, 0x3b, 0x8f, 0xa5, 0x32, 0x43, 0x4a, 0xcc, 0xbe, 0x8f, 0x99, 0x9c,
+	0x52, 0x1d, 0x8b, 0xfa, 0x06, 0x76, 0x67, 0xa9, 0x79, 0x32, 0x41, 0x7d, 0x68, 0x5f, 0x9b, 0x84,
+	0xef, 0x74, 0xdd, 0xde, 0xc6, 0xf1, 0xf6, 0x51, 0x69, 0x84, 0xe1, 0xe1, 0x1a, 0x0f, 0x5f, 0xc3,
+	0x76, 0x95, 0x34, 0x6d, 0x56, 0x7b, 0x52, 0x0d, 0xd0, 0xb0, 0x06, 0xb8, 0x80, 0xcd, 0x77, 0xc5,
+	0x8e, 0x77, 0xab, 0x0f, 0xa0, 0x29, 0x98, 0x1c, 0xa7, 0xcc, 0x18, 0x6a, 0xa2, 0xba, 0xaa, 0x6b,
+	0x55, 0xfd, 0x0c, 0x9d, 0x21, 0x53, 0x97, 0xda, 0xa2, 0x7f, 0xaa, 0x6c, 0xbc, 0x6d, 0x2c, 0xf5,
+	0xd6, 0xae, 0x7c, 0x02, 0x9b, 0xf5, 0xbe, 0x85, 0x57, 0x3d, 0x68, 0x19, 0x2f, 0x74, 0xd5, 0x45,
+	0xab, 0x2a, 0x38, 0x3c, 0x01, 0xf8, 0xc8, 0x79, 0x72, 0x39, 0x5b, 0xdb, 0xfa, 0x18, 0xab, 0xe6,
+	0x08, 0x2f, 0x60, 0x67, 0xc8, 0xd4, 0x30, 0x4f, 0xe2, 0x7a, 0x99, 0x7d, 0xf0, 0x04, 0x1f, 0x2b,
+	0x66, 0xf4, 0x65, 0x80, 0x9e, 0x40, 0xab, 0x94, 0x48, 0xbf, 0xa1, 0xbf, 0xdb, 0xae, 0x19, 0x66,
+	0xda, 0x18, 0x57, 0x8c, 0xf0, 0x25, 0x6c, 0x4d, 0xab, 0x16, 0xab, 0x58, 0x6a, 0xe7, 0x4e, 0x75,
+	0x1f, 0xd0, 0x87, 0x58, 0x08, 0x2e, 0x86, 0x8a, 0x28, 0xf9, 0xd7, 0xb1, 0xc2, 0xe7, 0xb0, 0x3e,
+	0xe0, 0x94, 0x0d, 0xf8, 0x38, 0xd3, 0x8b, 0x47, 0x9c, 0x56, 0x0c, 0xfd, 0xbb, 0x90, 0x45, 0x05,
+	0xa8, 0xf7, 0x76, 0x71, 0x19, 0x84, 0x3f, 0x1b, 0xd0, 0x99, 0xe9, 0x51, 0x0c, 0xb9, 0xcc, 0xb7,
+	0x00, 0xda, 0x5f, 0x04, 0x89, 0x54, 0xcc, 0x33, 0x5d, 0xc1, 0xc1, 0x75, 0x5c, 0x60, 0x11, 0x4f,
+	0x73, 0x22, 0xcc, 0xb9, 0xb9, 0xb8, 0x8e, 0xd1, 0x43, 0x80, 0x34, 0x96, 0x29, 0x51, 0xd1, 0x88,
+	0x51, 0x7d, 0x71, 0x2e, 0xb6, 0x32, 0xe8, 0x51, 0x31, 0x16, 0x65, 0xd2, 0xf7, 0xb4, 0x1d, 0x1d,
+	0x63, 0x47, 0xbd, 0x0b, 0x2e, 0x61, 0xf4, 0x14, 0x50, 0x2e, 0xe2, 0x94, 0x88, 0xc9, 0x55, 0x42,
+	0x14, 0xcb, 0xa2, 0xc9, 0xd5, 0x58, 0xea, 0x8b, 0x74, 0x71, 0xc7, 0x20, 0xe7, 0x25, 0xf0, 0x49,
+	0xa2, 0x3e, 0xec, 0xca, 0x11, 0xa1, 0xfc, 0xd6, 0x26, 0xb7, 0x34, 0x79, 0xa7, 0x04, 0x6a, 0xee,
+	0xf1, 0x6f, 0x17, 0xbc, 0xb3, 0xa2, 0x29, 0x7a, 0x0f, 0x9b, 0xf6, 0xa1, 0xa2, 0xc0, 0x0c, 0xb3,
+	0xe4, 0xd0, 0x03, 0x7f, 0x29, 0x96, 0x27, 0x93, 0xf0, 0x1e, 0x3a, 0x05, 0x38, 0xa3, 0xd4, 0x64,
+	0xd1, 0xfd, 0xb9, 0xc7, 0x6a, 0x0a, 0xec, 0xcd, 0xa7, 0x4b, 0xed, 0x2b, 0xd8, 0xc2, 0x2c, 0xe5,
+	0x3f, 0xd8, 0xff, 0xc9, 0x4f, 0xcd, 0xa9, 0x57, 0xea, 0x8a, 0x66, 0xdf, 0xff, 0x2a, 0xed, 0x0b,
+	0x58, 0xaf, 0x0f, 0x1a, 0x1d, 0x1a, 0xce, 0xfc, 0x89, 0xaf, 0x6e, 0xdc, 0xae, 0x5e, 0x3a, 0x3a,
+	0x98, 0x6a, 0xed, 0x83, 0x0a, 0xf6, 0x17, 0xf2, 0xa5, 0x76, 0x00, 0x1b, 0xd6, 0x1b, 0x44, 0x0f,
+	0x0c, 0x6d, 0xf1, 0xed, 0x07, 0x87, 0xcb, 0x20, 0x5d, 0xe4, 0xba, 0xa9, 0xff, 0x40, 0x9e, 0xfd,
+	0x19, 0x00, 0x40, 0x59, 0x4e, 0xa8, 0x4f, 0x06, 0x00, 0x00,
+}
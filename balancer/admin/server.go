@@ -0,0 +1,274 @@
+package admin
+
+//go:generate protoc --go_out=plugins=grpc:. admin.proto
+
+import (
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/open-lambda/load-balancer/balancer/routeTable"
+	"github.com/open-lambda/load-balancer/balancer/serverSet"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+/*
+ * Server implements the Admin service on top of the serverSet.Set of every
+ * pool. Every change goes through a set, which hands the new server list to
+ * the pickers in one step, so picks in flight see either the old list or the
+ * new one.
+ */
+type Server struct {
+	mu     sync.RWMutex
+	sets   map[string]*serverSet.Set
+	routes *routeTable.Table
+}
+
+// sets are by pool name
+func NewServer(sets map[string]*serverSet.Set) *Server {
+	return &Server{sets: sets}
+}
+
+// Replaces the pools, e.g. after a config reload added or removed some
+func (s *Server) SetPools(sets map[string]*serverSet.Set) {
+	s.mu.Lock()
+	s.sets = sets
+	s.mu.Unlock()
+}
+
+// Sets the routes whose splits SetSplit changes
+func (s *Server) SetRoutes(routes *routeTable.Table) {
+	s.mu.Lock()
+	s.routes = routes
+	s.mu.Unlock()
+}
+
+func (s *Server) pool(name string) (*serverSet.Set, error) {
+	if name == "" {
+		name = routeTable.DefaultPool
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	set, ok := s.sets[name]
+	if !ok {
+		return nil, grpc.Errorf(codes.NotFound, "no pool named %s", name)
+	}
+	return set, nil
+}
+
+// Serves the Admin service on lis until it fails
+func (s *Server) Serve(lis net.Listener) error {
+	gs := grpc.NewServer()
+	RegisterAdminServer(gs, s)
+	return gs.Serve(lis)
+}
+
+func (s *Server) ListBackends(ctx context.Context, req *ListBackendsRequest) (*ListBackendsReply, error) {
+	var names []string
+	if req.Pool != "" {
+		names = []string{req.Pool}
+	} else {
+		s.mu.RLock()
+		for name := range s.sets {
+			names = append(names, name)
+		}
+		s.mu.RUnlock()
+		sort.Strings(names)
+	}
+
+	reply := &ListBackendsReply{}
+	for _, name := range names {
+		set, err := s.pool(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, state := range set.States() {
+			reply.Backends = append(reply.Backends, backend(name, state))
+		}
+	}
+
+	return reply, nil
+}
+
+func (s *Server) AddBackend(ctx context.Context, req *BackendRequest) (*BackendReply, error) {
+	if req.Address == "" {
+		return nil, grpc.Errorf(codes.InvalidArgument, "no address given")
+	}
+	set, err := s.pool(req.Pool)
+	if err != nil {
+		return nil, err
+	}
+	if err := set.Add(req.Address); err != nil {
+		return nil, setErr(err)
+	}
+	log.Printf("admin: added backend %s to pool %s", req.Address, poolName(req.Pool))
+
+	return reply(set, req.Pool, req.Address)
+}
+
+func (s *Server) RemoveBackend(ctx context.Context, req *BackendRequest) (*BackendReply, error) {
+	set, err := s.pool(req.Pool)
+	if err != nil {
+		return nil, err
+	}
+	state, err := set.State(req.Address)
+	if err != nil {
+		return nil, setErr(err)
+	}
+	if err := set.Remove(req.Address); err != nil {
+		return nil, setErr(err)
+	}
+	log.Printf("admin: removed backend %s from pool %s", req.Address, poolName(req.Pool))
+
+	return &BackendReply{Backend: backend(req.Pool, state)}, nil
+}
+
+func (s *Server) DrainBackend(ctx context.Context, req *DrainRequest) (*BackendReply, error) {
+	set, err := s.pool(req.Pool)
+	if err != nil {
+		return nil, err
+	}
+	if err := set.SetDraining(req.Address, !req.Resume); err != nil {
+		return nil, setErr(err)
+	}
+	if req.Resume {
+		log.Printf("admin: resumed backend %s in pool %s", req.Address, poolName(req.Pool))
+	} else {
+		log.Printf("admin: draining backend %s in pool %s", req.Address, poolName(req.Pool))
+	}
+
+	return reply(set, req.Pool, req.Address)
+}
+
+func (s *Server) SetWeight(ctx context.Context, req *SetWeightRequest) (*BackendReply, error) {
+	if req.Weight < 0 {
+		return nil, grpc.Errorf(codes.InvalidArgument, "weight %d is negative", req.Weight)
+	}
+	set, err := s.pool(req.Pool)
+	if err != nil {
+		return nil, err
+	}
+	if err := set.SetWeight(req.Address, int(req.Weight)); err != nil {
+		return nil, setErr(err)
+	}
+	log.Printf("admin: set weight of %s in pool %s to %d", req.Address, poolName(req.Pool), req.Weight)
+
+	return reply(set, req.Pool, req.Address)
+}
+
+func (s *Server) SetSplit(ctx context.Context, req *SetSplitRequest) (*SetSplitReply, error) {
+	s.mu.RLock()
+	routes := s.routes
+	s.mu.RUnlock()
+
+	var split *routeTable.Split
+	ok := false
+	if routes != nil {
+		split, ok = routes.Split(req.Route)
+	}
+	if !ok {
+		return nil, grpc.Errorf(codes.NotFound, "no route named %s with a split", req.Route)
+	}
+
+	weights := make(map[string]int)
+	for _, pw := range req.Weights {
+		if pw.Weight < 0 {
+			return nil, grpc.Errorf(codes.InvalidArgument, "weight %d of pool %s is negative", pw.Weight, pw.Pool)
+		}
+		weights[pw.Pool] = int(pw.Weight)
+	}
+	if err := split.SetWeights(weights); err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
+	reply := &SetSplitReply{}
+	for _, pw := range split.Weights() {
+		reply.Weights = append(reply.Weights, &PoolWeight{Pool: pw.Pool, Weight: int32(pw.Weight)})
+	}
+	log.Printf("admin: set split of route %s to %v", req.Route, split.Weights())
+
+	return reply, nil
+}
+
+func (s *Server) MirrorStats(ctx context.Context, req *MirrorStatsRequest) (*MirrorStatsReply, error) {
+	s.mu.RLock()
+	routes := s.routes
+	s.mu.RUnlock()
+
+	var mirror *routeTable.Mirror
+	ok := false
+	if routes != nil {
+		mirror, ok = routes.Mirror(req.Route)
+	}
+	if !ok {
+		return nil, grpc.Errorf(codes.NotFound, "no route named %s with a mirror", req.Route)
+	}
+
+	stats := mirror.Stats()
+	reply := &MirrorStatsReply{
+		Pool:       mirror.Pool,
+		Fraction:   mirror.Fraction,
+		Compared:   stats.Compared,
+		Mismatched: stats.Mismatched,
+	}
+	if stats.Compared > 0 {
+		reply.PrimaryLatencyUs = int64(stats.PrimaryLatency/time.Microsecond) / stats.Compared
+		reply.ShadowLatencyUs = int64(stats.ShadowLatency/time.Microsecond) / stats.Compared
+	}
+	var codeList []codes.Code
+	for code := range stats.Codes {
+		codeList = append(codeList, code)
+	}
+	sort.Slice(codeList, func(i, j int) bool { return codeList[i] < codeList[j] })
+	for _, code := range codeList {
+		reply.Codes = append(reply.Codes, &CodeCount{Code: code.String(), Count: stats.Codes[code]})
+	}
+
+	return reply, nil
+}
+
+func reply(set *serverSet.Set, pool string, server string) (*BackendReply, error) {
+	state, err := set.State(server)
+	if err != nil {
+		// Removed by someone else in the meantime
+		return nil, setErr(err)
+	}
+
+	return &BackendReply{Backend: backend(pool, state)}, nil
+}
+
+func poolName(pool string) string {
+	if pool == "" {
+		return routeTable.DefaultPool
+	}
+	return pool
+}
+
+func backend(pool string, state serverSet.ServerState) *Backend {
+	return &Backend{
+		Pool:     poolName(pool),
+		Address:  state.Server,
+		Healthy:  state.Healthy,
+		Ejected:  state.Ejected,
+		Draining: state.Draining,
+		Weight:   int32(state.Weight),
+	}
+}
+
+// Maps an error from the set to a status for the admin client
+func setErr(err error) error {
+	switch err {
+	case serverSet.ErrUnknownServer:
+		return grpc.Errorf(codes.NotFound, "%v", err)
+	case serverSet.ErrDuplicateServer:
+		return grpc.Errorf(codes.AlreadyExists, "%v", err)
+	default:
+		return grpc.Errorf(codes.Internal, "%v", err)
+	}
+}
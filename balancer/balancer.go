@@ -1,102 +1,411 @@
 package balancer
 
 import (
-	"bytes"
-	"container/list"
-	"io"
+	"crypto/tls"
+	"fmt"
+	"log"
 	"net"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/open-lambda/load-balancer/balancer/connPeek"
+	"github.com/open-lambda/load-balancer/balancer/msgPeek"
+	"github.com/open-lambda/load-balancer/balancer/outlierDetect"
 	"github.com/open-lambda/load-balancer/balancer/serverPick"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/transport"
 )
 
 type LoadBalancer struct {
+	// Picker and request policies, see Reconfigure for changing them while
+	// the balancer runs
+	Settings
+	// Deprecated: set Picker instead. Used through serverPick.Adapt if
+	// Picker isn't set when Run is called.
 	Chooser   serverPick.ServerPicker
 	Address   string
 	Consumers int
-	Conns     chan *net.TCPConn
+	Conns     chan *Conn
+	// Optional, addresses to accept clients on instead of just Address
+	Listeners []*Listener
+	// Optional, connects to backends instead of a plain TCP dial
+	Dial DialFunc
+	// How connections to backends are shared, read when the first one is made
+	Pooling PoolPolicy
+	// Optional, told the outcome of every forwarded request
+	Outliers *outlierDetect.Detector
+	// Optional, decodes request fields for the pickers to see
+	Parsers *msgPeek.Table
+
+	live        atomic.Value
+	latencies   methodLatencies
+	retryBudget retryBudget
+	tracker     connTracker
+	poolOnce    sync.Once
+	pool        *backendPool
+}
+
+// Returns the pool of backend connections, set up on first use
+func (lb *LoadBalancer) backends() *backendPool {
+	lb.poolOnce.Do(func() {
+		lb.pool = newBackendPool(lb.Dial, lb.Pooling)
+	})
+	return lb.pool
 }
 
-// Actually send the request to "best" backend (first one for now)
-func (lb *LoadBalancer) ForwardRequest(peekconn *connPeek.ReaderConn, clientconn, serverconn *net.TCPConn, buf bytes.Buffer) {
-	peekconn.SecondConn(serverconn) // This is so we can close serverconn cleanly
-	io.Copy(serverconn, &buf)
-	io.Copy(clientconn, serverconn)
+/*
+ * Keeps PoolPolicy.Warm connections open to each of servers, replacing the
+ * servers given before, so their first requests don't wait on a dial.
+ */
+func (lb *LoadBalancer) WarmBackends(servers []string) {
+	lb.backends().warmBackends(servers)
 }
 
-func (lb *LoadBalancer) HandleConn(clientconn *net.TCPConn) {
-	// Will need access to buf later for proxying
-	var buf bytes.Buffer
-	r := io.TeeReader(clientconn, &buf)
+// Send a single stream to the backend(s) chosen by the picker for l
+func (lb *LoadBalancer) ForwardStream(st transport.ServerTransport, stream *transport.Stream, l *Listener) {
+	// Settings stay the same for the whole request even if they are changed
+	cfg := lb.settings()
+	picker := l.picker(cfg.Picker)
+	backends := lb.backends()
 
-	// Using conn to peek at the method name w/o affecting buf
-	peekconn := &connPeek.ReaderConn{Reader: r, Conn: clientconn}
-	st, err := transport.NewServerTransport("http2", peekconn, 100, nil)
-	if err != nil {
-		panic(err)
+	info := &serverPick.PickInfo{
+		Method: stream.Method(),
+		Peer:   st.RemoteAddr(),
+		Fields: make(map[string]string),
+	}
+	if md, ok := metadata.FromContext(stream.Context()); ok {
+		info.Metadata = md
+		if authority := md[":authority"]; len(authority) > 0 {
+			info.Authority = authority[0]
+		}
 	}
 
-	st.HandleStreams(func(stream *transport.Stream) {
-		// Get method name
-		name := stream.Method()
+	info.Deadline = cfg.Timeouts.requestDeadline(stream.Context(), info.Method)
+	ctx, cancel := cfg.Timeouts.backendContext(stream.Context(), info.Deadline)
+	defer cancel()
 
-		// Make decision about which backend(s) to connect to
-		servers, err := lb.Chooser.ChooseServers(name, *list.New())
+	// Look inside the first message if we know the service's proto. Whatever
+	// is read here has to be replayed to the backend.
+	var prefix []byte
+	if m, ok := lb.lookupParser(info.Method); ok {
+		var msg []byte
+		var err error
+		expired := expireReads(st, stream, info.Deadline)
+		prefix, msg, err = peekMessage(stream)
+		if expired() {
+			return
+		}
 		if err != nil {
-			panic(err)
+			writeStreamErr(st, stream, err)
+			return
 		}
+		if msg != nil {
+			fields, err := m.Decode(msg)
+			if err != nil {
+				log.Printf("could not decode request to %s: %v", info.Method, err)
+			}
+			info.Fields = fields
+		}
+	}
 
-		serveraddr, err := net.ResolveTCPAddr("tcp", servers[0])
+	if err := ctx.Err(); err != nil {
+		// The deadline passed or the client went away while peeking
+		writeStreamErr(st, stream, transport.ContextErr(err))
+		return
+	}
+
+	// Make decision about which backend(s) to connect to
+	pick, err := picker.Pick(info)
+	if err == nil && len(pick.Servers) == 0 {
+		cancelPick(pick)
+		err = serverPick.ErrNoServers
+	}
+	if err != nil {
+		log.Printf("could not choose server for %s: %v", info.Method, err)
+		st.WriteStatus(stream, pickErrCode(err), err.Error())
+		return
+	}
+
+	if cfg.Retries != nil {
+		lb.retryBudget.deposit(cfg.Retries.BudgetRatio)
+	}
+	if pick.Mirror != nil && !lb.unary(cfg, info.Method) {
+		// Buffering would hold up a streaming client waiting on responses
+		// before it half-closes, so only known unary methods are copied
+		cancelPick(&pick.Mirror.PickResult)
+		pick.Mirror = nil
+	}
+
+	// Hedging, retries and mirroring need the whole request at hand to
+	// send it again
+	hedge := cfg.Hedging.hedged(info.Method) && len(pick.Servers) > 1
+	retry := cfg.Retries.retried(info.Method)
+	var req []byte
+	buffered := false
+	if hedge || retry || pick.Mirror != nil {
+		expired := expireReads(st, stream, info.Deadline)
+		req, buffered, err = bufferRequest(stream, prefix)
+		if expired() {
+			cancelPick(pick)
+			return
+		}
 		if err != nil {
-			panic(err)
+			cancelPick(pick)
+			writeStreamErr(st, stream, err)
+			return
 		}
+		// If it was too big to send twice it's forwarded the normal way
+		prefix = req
+	}
 
-		// nil argument is the local address
-		serverconn, err := net.DialTCP("tcp", nil, serveraddr)
-		if err != nil {
-			panic(err)
+	var primary chan<- serverPick.DoneInfo
+	if buffered && pick.Mirror != nil {
+		primary = lb.mirrorStream(cfg, stream, info, pick.Mirror, backends, req)
+	} else if pick.Mirror != nil {
+		cancelPick(&pick.Mirror.PickResult)
+	}
+
+	start := time.Now()
+	var res streamResult
+	switch {
+	case buffered && hedge:
+		res = lb.hedgeStream(ctx, cfg, st, stream, pick, backends, req)
+	case buffered && retry:
+		res = lb.retryStream(ctx, cfg, st, stream, info, picker, pick, backends, req)
+	default:
+		res = lb.forward(ctx, cfg, st, stream, info, pick, backends, prefix)
+	}
+
+	if primary != nil {
+		primary <- serverPick.DoneInfo{
+			Code:          res.code,
+			Completed:     res.completed,
+			Latency:       time.Since(start),
+			BytesSent:     res.sent,
+			BytesReceived: res.received,
 		}
+	}
+}
+
+// Proxies a stream to the picked server, returning how it went
+func (lb *LoadBalancer) forward(ctx context.Context, cfg *Settings, st transport.ServerTransport, stream *transport.Stream, info *serverPick.PickInfo, pick *serverPick.PickResult, backends *backendPool, prefix []byte) streamResult {
+	server := pick.Servers[0]
+	if pick.Start != nil {
+		pick.Start(server)
+	}
+
+	ct, err := backends.get(ctx, server)
+	if se, ok := err.(transport.StreamError); ok {
+		// Deadline or cancellation while waiting on the connection
+		st.WriteStatus(stream, se.Code, se.Desc)
+		lb.done(cfg, info.Method, pick, serverPick.DoneInfo{Server: server, Code: se.Code})
+		return streamResult{code: se.Code}
+	}
+	if err != nil {
+		log.Printf("could not connect to %s: %v", server, err)
+		st.WriteStatus(stream, codes.Unavailable, fmt.Sprintf("could not connect to backend: %v", err))
+		lb.done(cfg, info.Method, pick, serverPick.DoneInfo{Server: server, Code: codes.Unavailable})
+		return streamResult{code: codes.Unavailable}
+	}
 
-		go lb.ForwardRequest(peekconn, clientconn, serverconn, buf)
+	start := time.Now()
+	res := proxyStream(ctx, st, stream, ct, server, prefix)
+	lb.done(cfg, info.Method, pick, serverPick.DoneInfo{
+		Server:        server,
+		Code:          res.code,
+		Completed:     res.completed,
+		Latency:       time.Since(start),
+		BytesSent:     res.sent,
+		BytesReceived: res.received,
 	})
+
+	return res
 }
 
-func (lb *LoadBalancer) ConnConsumer() {
-	for {
-		conn := <-lb.Conns
-		lb.HandleConn(conn)
+// Lets the pickers drop a pick the request never got to use, and its mirror
+func cancelPick(pick *serverPick.PickResult) {
+	if pick.Cancel != nil {
+		pick.Cancel()
+	}
+	if pick.Mirror != nil && pick.Mirror.Cancel != nil {
+		pick.Mirror.Cancel()
+	}
+}
+
+// Returns the parser for a method, if it can be peeked at
+func (lb *LoadBalancer) lookupParser(method string) (*msgPeek.Method, bool) {
+	if lb.Parsers == nil {
+		return nil, false
+	}
+	m, ok := lb.Parsers.Lookup(method)
+	if !ok || m.ClientStreaming {
+		return nil, false
+	}
+
+	return m, true
+}
+
+// Whether method is known to be unary, from its parser or the retry policy
+func (lb *LoadBalancer) unary(cfg *Settings, method string) bool {
+	if cfg.Retries.retried(method) {
+		return true
 	}
+	if lb.Parsers == nil {
+		return false
+	}
+	m, ok := lb.Parsers.Lookup(method)
+	return ok && !m.ClientStreaming && !m.ServerStreaming
 }
 
-func (lb *LoadBalancer) Run() {
-	tcpaddr, err := net.ResolveTCPAddr("tcp", lb.Address)
+// Tells the picker and outlier detection how a request to a server went
+func (lb *LoadBalancer) done(cfg *Settings, method string, pick *serverPick.PickResult, info serverPick.DoneInfo) {
+	if lb.Outliers != nil {
+		lb.Outliers.Report(info.Server, info.Code)
+	}
+	if info.Completed && cfg.Hedging != nil && cfg.Hedging.Percentile > 0 {
+		lb.latencies.add(method, info.Latency)
+	}
+	if pick.Done != nil {
+		pick.Done(info)
+	}
+}
+
+func (lb *LoadBalancer) HandleConn(clientconn *Conn) {
+	conn, err := clientconn.Listener.wrap(clientconn.Conn)
 	if err != nil {
-		panic(err)
+		log.Printf("TLS handshake with %v failed: %v", clientconn.RemoteAddr(), err)
+		clientconn.Close()
+		return
+	}
+
+	var authInfo credentials.AuthInfo
+	if tlsconn, ok := conn.(*tls.Conn); ok {
+		authInfo = credentials.TLSInfo{State: tlsconn.ConnectionState()}
 	}
 
-	lis, err := net.ListenTCP("tcp", tcpaddr)
+	st, err := transport.NewServerTransport("http2", conn, 100, authInfo)
 	if err != nil {
-		panic(err)
+		// No stream to report the error on yet, the client sees the
+		// connection close
+		log.Printf("could not set up transport for %v: %v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
 	}
 
-	for i := 0; i < lb.Consumers; i++ {
-		go lb.ConnConsumer()
+	c := &trackedConn{st: st}
+	if !lb.tracker.add(c) {
+		st.Close()
+		return
 	}
+	defer lb.tracker.remove(c)
+
+	var wg sync.WaitGroup
+
+	// Returns once the client connection is closed
+	st.HandleStreams(func(stream *transport.Stream) {
+		wg.Add(1)
+		lb.tracker.streamStarted(c)
+		go func() {
+			defer wg.Done()
+			defer lb.tracker.streamDone(c)
+			lb.ForwardStream(st, stream, clientconn.Listener)
+		}()
+	})
+
+	wg.Wait()
+}
+
+// Maps an error from a ServerPicker to the status code sent to the client
+func pickErrCode(err error) codes.Code {
+	switch err {
+	case serverPick.ErrNoServers:
+		return codes.Unavailable
+	case serverPick.ErrOverloaded:
+		return codes.ResourceExhausted
+	case serverPick.ErrNoRoute:
+		return codes.Unimplemented
+	default:
+		return codes.Internal
+	}
+}
 
+/*
+ * Takes client connections off Conns until Shutdown is called. Each one is
+ * served on its own goroutine, since HandleConn only returns once the client
+ * goes away.
+ */
+func (lb *LoadBalancer) ConnConsumer() {
+	done := lb.tracker.shuttingDown()
 	for {
-		conn, err := lis.AcceptTCP()
+		select {
+		case conn := <-lb.Conns:
+			go lb.HandleConn(conn)
+		case <-done:
+			return
+		}
+	}
+}
+
+/*
+ * Accepts connections on every listener (or just Address if there are none)
+ * until one of them fails or Shutdown is called; always returns a non-nil
+ * error, ErrShutdown in the latter case.
+ */
+func (lb *LoadBalancer) Run() error {
+	if lb.Picker == nil && lb.Chooser != nil {
+		lb.Picker = serverPick.Adapt(lb.Chooser)
+	}
+	listeners := lb.Listeners
+	if len(listeners) == 0 {
+		listeners = []*Listener{{Network: "tcp", Address: lb.Address}}
+	}
+
+	var open []net.Listener
+	defer func() {
+		for _, lis := range open {
+			lis.Close()
+		}
+	}()
+	for _, l := range listeners {
+		lis, err := l.listen()
 		if err != nil {
-			panic(err)
+			return err
 		}
-		lb.Conns <- conn
+		open = append(open, lis)
+		if !lb.tracker.addListener(lis) {
+			return ErrShutdown
+		}
+	}
+
+	for i := 0; i < lb.Consumers; i++ {
+		go lb.ConnConsumer()
 	}
+
+	// The first listener to stop takes the others down with it
+	errs := make(chan error, len(open))
+	for i, lis := range open {
+		go func(lis net.Listener, l *Listener) {
+			errs <- lb.serve(lis, l)
+		}(lis, listeners[i])
+	}
+
+	return <-errs
 }
 
-// TODO add support for multiple addresses?
-func (lb *LoadBalancer) Init(address string, chooser serverPick.ServerPicker, consumers int) {
-	lb.Address = address
+func (lb *LoadBalancer) Init(address string, chooser serverPick.ServerPicker, consumers int, opts ...Option) {
 	lb.Chooser = chooser
+	lb.InitPicker(address, serverPick.Adapt(chooser), consumers, opts...)
+}
+
+func (lb *LoadBalancer) InitPicker(address string, picker serverPick.Picker, consumers int, opts ...Option) {
+	lb.Address = address
+	lb.Picker = picker
 	lb.Consumers = consumers
-	lb.Conns = make(chan *net.TCPConn)
+	lb.Conns = make(chan *Conn)
+	for _, opt := range opts {
+		opt(lb)
+	}
 }
@@ -0,0 +1,330 @@
+package balancer
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/open-lambda/load-balancer/balancer/serverPick"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// The one method test backends serve
+const echoMethod = "/test.Echo/Call"
+
+// A listener whose connections are in-memory pipes made by dial
+type pipeListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{conns: make(chan net.Conn), done: make(chan struct{})}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, errors.New("listener closed")
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: "pipe", Net: "pipe"}
+}
+
+func (l *pipeListener) dial(ctx context.Context, addr string) (net.Conn, error) {
+	client, server := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-l.done:
+		return nil, errors.New("listener closed")
+	}
+}
+
+// Passes messages through as they are, so tests need no generated code
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	return *v.(*[]byte), nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	*v.(*[]byte) = append([]byte(nil), data...)
+	return nil
+}
+
+func (rawCodec) String() string {
+	return "raw"
+}
+
+// An in-memory backend answering echoMethod with handler
+type testBackend struct {
+	lis     *pipeListener
+	srv     *grpc.Server
+	handler func(ctx context.Context, req []byte) ([]byte, error)
+}
+
+func newTestBackend(handler func(ctx context.Context, req []byte) ([]byte, error)) *testBackend {
+	b := &testBackend{
+		lis:     newPipeListener(),
+		srv:     grpc.NewServer(grpc.CustomCodec(rawCodec{})),
+		handler: handler,
+	}
+	b.srv.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "test.Echo",
+		HandlerType: (*interface{})(nil),
+		Methods:     []grpc.MethodDesc{{MethodName: "Call", Handler: b.call}},
+	}, b)
+	go b.srv.Serve(b.lis)
+
+	return b
+}
+
+func (b *testBackend) call(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	var req []byte
+	if err := dec(&req); err != nil {
+		return nil, err
+	}
+	resp, err := b.handler(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Replies with the backend's name and the request
+func echo(name string) func(ctx context.Context, req []byte) ([]byte, error) {
+	return func(ctx context.Context, req []byte) ([]byte, error) {
+		return []byte(name + ":" + string(req)), nil
+	}
+}
+
+// Sends every request to servers, in order, and records how they went
+type testPicker struct {
+	servers []string
+	done    chan serverPick.DoneInfo
+}
+
+func newTestPicker(servers ...string) *testPicker {
+	return &testPicker{servers: servers, done: make(chan serverPick.DoneInfo, 16)}
+}
+
+func (p *testPicker) Pick(info *serverPick.PickInfo) (*serverPick.PickResult, error) {
+	return &serverPick.PickResult{
+		Servers: p.servers,
+		Done: func(done serverPick.DoneInfo) {
+			p.done <- done
+		},
+	}, nil
+}
+
+func (p *testPicker) SetServers(servers []string) {}
+
+// Waits for the outcome of a request to one server
+func (p *testPicker) next(t *testing.T) serverPick.DoneInfo {
+	select {
+	case done := <-p.done:
+		return done
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a request to finish")
+	}
+	return serverPick.DoneInfo{}
+}
+
+// A balancer running on an in-memory listener in front of in-memory backends
+type testEnv struct {
+	lb       *LoadBalancer
+	lis      *pipeListener
+	backends map[string]*testBackend
+	// What Run returned
+	errs chan error
+}
+
+func newTestEnv(picker serverPick.Picker, backends map[string]*testBackend, opts ...Option) *testEnv {
+	e := &testEnv{
+		lb:       &LoadBalancer{},
+		lis:      newPipeListener(),
+		backends: backends,
+		errs:     make(chan error, 1),
+	}
+	opts = append([]Option{WithListener(e.lis), WithDialer(e.dialBackend)}, opts...)
+	e.lb.InitPicker("pipe", picker, 2, opts...)
+	go func() {
+		e.errs <- e.lb.Run()
+	}()
+
+	return e
+}
+
+func (e *testEnv) dialBackend(ctx context.Context, addr string) (net.Conn, error) {
+	b, ok := e.backends[addr]
+	if !ok {
+		return nil, errors.New("no backend at " + addr)
+	}
+	return b.lis.dial(ctx, addr)
+}
+
+// Connects a client to the balancer
+func (e *testEnv) client(t *testing.T) *grpc.ClientConn {
+	dial := func(addr string, timeout time.Duration) (net.Conn, error) {
+		ctx := context.Background()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return e.lis.dial(ctx, addr)
+	}
+	cc, err := grpc.Dial("balancer", grpc.WithInsecure(), grpc.WithCodec(rawCodec{}),
+		grpc.WithDialer(dial), grpc.WithBlock(), grpc.WithTimeout(5*time.Second))
+	if err != nil {
+		t.Fatalf("could not connect to the balancer: %v", err)
+	}
+
+	return cc
+}
+
+// Waits for Run to return
+func (e *testEnv) runErr(t *testing.T) error {
+	select {
+	case err := <-e.errs:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run still going")
+	}
+	return nil
+}
+
+func (e *testEnv) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	e.lb.Shutdown(ctx)
+	for _, b := range e.backends {
+		b.srv.Stop()
+		b.lis.Close()
+	}
+}
+
+func call(ctx context.Context, cc *grpc.ClientConn, req string) (string, error) {
+	in, out := []byte(req), []byte(nil)
+	err := grpc.Invoke(ctx, echoMethod, &in, &out, cc)
+	return string(out), err
+}
+
+func TestForwardsRPC(t *testing.T) {
+	picker := newTestPicker("a")
+	e := newTestEnv(picker, map[string]*testBackend{
+		"a": newTestBackend(echo("a")),
+	})
+	defer e.close()
+	cc := e.client(t)
+	defer cc.Close()
+
+	resp, err := call(context.Background(), cc, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != "a:hello" {
+		t.Errorf("got response %q, want %q", resp, "a:hello")
+	}
+	done := picker.next(t)
+	if done.Server != "a" || done.Code != codes.OK || !done.Completed {
+		t.Errorf("got %+v, want a completed OK request to a", done)
+	}
+
+	// A second request reuses the backend connection
+	if resp, err = call(context.Background(), cc, "again"); err != nil || resp != "a:again" {
+		t.Errorf("got %q, %v on the second request, want %q", resp, err, "a:again")
+	}
+}
+
+func TestForwardsStatus(t *testing.T) {
+	picker := newTestPicker("a")
+	e := newTestEnv(picker, map[string]*testBackend{
+		"a": newTestBackend(func(ctx context.Context, req []byte) ([]byte, error) {
+			return nil, grpc.Errorf(codes.NotFound, "no %s here", req)
+		}),
+	})
+	defer e.close()
+	cc := e.client(t)
+	defer cc.Close()
+
+	_, err := call(context.Background(), cc, "key")
+	if grpc.Code(err) != codes.NotFound || grpc.ErrorDesc(err) != "no key here" {
+		t.Errorf("got %v, want NotFound from the backend", err)
+	}
+	if done := picker.next(t); done.Code != codes.NotFound || !done.Completed {
+		t.Errorf("got %+v, want a completed NotFound request", done)
+	}
+}
+
+func TestUnreachableBackend(t *testing.T) {
+	picker := newTestPicker("missing")
+	e := newTestEnv(picker, map[string]*testBackend{})
+	defer e.close()
+	cc := e.client(t)
+	defer cc.Close()
+
+	if _, err := call(context.Background(), cc, "hello"); grpc.Code(err) != codes.Unavailable {
+		t.Errorf("got %v, want Unavailable", err)
+	}
+	if done := picker.next(t); done.Server != "missing" || done.Code != codes.Unavailable {
+		t.Errorf("got %+v, want an Unavailable request to missing", done)
+	}
+}
+
+func TestWrapNilListener(t *testing.T) {
+	var l *Listener
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	if conn, err := l.wrap(server); err != nil || conn != server {
+		t.Errorf("got %v, %v, want the connection as it is", conn, err)
+	}
+}
+
+func TestConnWithoutListener(t *testing.T) {
+	picker := newTestPicker("a")
+	b := newTestBackend(echo("a"))
+	defer func() {
+		b.srv.Stop()
+		b.lis.Close()
+	}()
+	lb := &LoadBalancer{}
+	lb.InitPicker("", picker, 1, WithDialer(b.lis.dial))
+	go lb.ConnConsumer()
+	defer lb.Shutdown(context.Background())
+
+	// Connections handed to the balancer directly have no Listener
+	dial := func(addr string, timeout time.Duration) (net.Conn, error) {
+		client, server := net.Pipe()
+		lb.Conns <- &Conn{Conn: server}
+		return client, nil
+	}
+	cc, err := grpc.Dial("balancer", grpc.WithInsecure(), grpc.WithCodec(rawCodec{}),
+		grpc.WithDialer(dial), grpc.WithBlock(), grpc.WithTimeout(5*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	if resp, err := call(context.Background(), cc, "hello"); err != nil || resp != "a:hello" {
+		t.Errorf("got %q, %v, want %q", resp, err, "a:hello")
+	}
+}
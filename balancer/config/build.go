@@ -0,0 +1,321 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/open-lambda/load-balancer/balancer"
+	"github.com/open-lambda/load-balancer/balancer/healthCheck"
+	"github.com/open-lambda/load-balancer/balancer/outlierDetect"
+	"github.com/open-lambda/load-balancer/balancer/routeTable"
+	"github.com/open-lambda/load-balancer/balancer/serverPick"
+	"google.golang.org/grpc/codes"
+)
+
+func (p *Pool) hashKey() serverPick.HashKey {
+	switch {
+	case p.HashKey != "":
+		return serverPick.HashKey{Source: serverPick.HashMetadata, Name: p.HashKey}
+	case p.HashField != "":
+		return serverPick.HashKey{Source: serverPick.HashField, Name: p.HashField}
+	}
+
+	return serverPick.HashKey{Source: serverPick.HashMethod}
+}
+
+// Builds the pool's picker over servers
+func (p *Pool) NewPicker(servers []string) serverPick.ServerPicker {
+	switch p.Picker {
+	case "random":
+		return serverPick.NewRandPicker(servers)
+	case "ewma":
+		return serverPick.NewEWMAPicker(servers, p.Decay.Duration)
+	case "p2c":
+		return serverPick.NewP2CPicker(servers)
+	case "roundrobin":
+		return serverPick.NewRoundRobin(servers)
+	case "weighted":
+		return serverPick.NewWeightedRoundRobin(servers, p.Weights)
+	case "hash":
+		return serverPick.NewConsistentHash(servers, p.hashKey(), p.Replicas)
+	case "boundedhash":
+		return serverPick.NewBoundedLoadHash(servers, p.hashKey(), p.Replicas, p.LoadFactor)
+	default:
+		return serverPick.NewFirstTwo(servers)
+	}
+}
+
+// Whether a picker built from p would be built the same from other
+func (p *Pool) samePicker(other *Pool) bool {
+	return p.Picker == other.Picker && p.HashKey == other.HashKey && p.HashField == other.HashField &&
+		p.Replicas == other.Replicas && p.LoadFactor == other.LoadFactor &&
+		p.Decay == other.Decay
+}
+
+func (h *HealthCheck) config() healthCheck.Config {
+	conf := healthCheck.DefaultConfig
+	if h == nil {
+		return conf
+	}
+
+	conf.Service = h.Service
+	if h.Interval.Duration > 0 {
+		conf.Interval = h.Interval.Duration
+	}
+	if h.Timeout.Duration > 0 {
+		conf.Timeout = h.Timeout.Duration
+	}
+	if h.UnhealthyThreshold > 0 {
+		conf.UnhealthyThreshold = h.UnhealthyThreshold
+	}
+	if h.HealthyThreshold > 0 {
+		conf.HealthyThreshold = h.HealthyThreshold
+	}
+
+	return conf
+}
+
+func (o *OutlierDetection) config() outlierDetect.Config {
+	conf := outlierDetect.DefaultConfig
+	if o == nil {
+		return conf
+	}
+
+	if o.ConsecutiveErrors != nil {
+		conf.ConsecutiveErrors = *o.ConsecutiveErrors
+	}
+	if o.ErrorRate != nil {
+		conf.ErrorRate = *o.ErrorRate
+	}
+	if o.MinRequests > 0 {
+		conf.MinRequests = o.MinRequests
+	}
+	if o.Interval.Duration > 0 {
+		conf.Interval = o.Interval.Duration
+	}
+	if o.BaseEjectionTime.Duration > 0 {
+		conf.BaseEjectionTime = o.BaseEjectionTime.Duration
+	}
+	if o.MaxEjectionTime.Duration > 0 {
+		conf.MaxEjectionTime = o.MaxEjectionTime.Duration
+	}
+	if o.MaxEjectionPercent > 0 {
+		conf.MaxEjectionPercent = o.MaxEjectionPercent
+	}
+	if len(o.FailureCodes) > 0 {
+		conf.FailureCodes = []codes.Code{}
+		for _, name := range o.FailureCodes {
+			conf.FailureCodes = append(conf.FailureCodes, codeNames[name])
+		}
+	}
+
+	return conf
+}
+
+func (t *Timeouts) policy() *balancer.TimeoutPolicy {
+	if t == nil {
+		return nil
+	}
+
+	return &balancer.TimeoutPolicy{
+		Defaults:   durations(t.Defaults),
+		Default:    t.Default.Duration,
+		Max:        durations(t.Max),
+		DefaultMax: t.DefaultMax.Duration,
+		Overhead:   t.Overhead.Duration,
+	}
+}
+
+func (c *Connections) policy() balancer.PoolPolicy {
+	if c == nil {
+		return balancer.PoolPolicy{}
+	}
+
+	return balancer.PoolPolicy{
+		MaxStreams:  c.MaxStreams,
+		MaxAge:      c.MaxAge.Duration,
+		IdleTimeout: c.IdleTimeout.Duration,
+		Warm:        c.Warm,
+	}
+}
+
+func durations(m map[string]Duration) map[string]time.Duration {
+	res := make(map[string]time.Duration, len(m))
+	for k, d := range m {
+		res[k] = d.Duration
+	}
+
+	return res
+}
+
+func (r *Retries) policy() *balancer.RetryPolicy {
+	if r == nil {
+		return nil
+	}
+
+	rp := &balancer.RetryPolicy{
+		Methods:     r.Methods,
+		BudgetRatio: r.BudgetRatio,
+	}
+	for _, name := range r.RetryableCodes {
+		rp.RetryableCodes = append(rp.RetryableCodes, codeNames[name])
+	}
+
+	return rp
+}
+
+func (h *Hedging) policy() *balancer.HedgePolicy {
+	if h == nil {
+		return nil
+	}
+
+	hp := &balancer.HedgePolicy{
+		Idempotent:  make(map[string]bool),
+		Delay:       h.Delay.Duration,
+		Percentile:  h.Percentile,
+		MaxAttempts: h.MaxAttempts,
+	}
+	for _, method := range h.Methods {
+		hp.Idempotent[method] = true
+	}
+
+	return hp
+}
+
+// Every pool by name, the top level one as "default" if it has servers
+func (c *Config) pools() map[string]Pool {
+	pools := make(map[string]Pool)
+	if len(c.Servers) > 0 {
+		pools[routeTable.DefaultPool] = c.Pool
+	}
+	for name, pool := range c.Pools {
+		pools[name] = pool
+	}
+
+	return pools
+}
+
+// split and mirror are only used if the route has Splits and a Mirror
+func (r *Route) route(split *routeTable.Split, mirror *routeTable.Mirror) routeTable.Route {
+	route := routeTable.Route{
+		Name:   r.Name,
+		Method: r.StringMatch.match(),
+		Pool:   r.Pool,
+	}
+	if len(r.Splits) > 0 {
+		route.Split = split
+	}
+	if r.Mirror != nil {
+		route.Mirror = mirror
+	}
+	if r.Authority != nil {
+		route.Authority = r.Authority.match()
+	}
+	for _, h := range r.Headers {
+		hm := routeTable.HeaderMatch{Name: strings.ToLower(h.Name)}
+		switch {
+		case h.Present != nil && *h.Present:
+			hm.Kind = routeTable.MatchPresent
+		case h.Present != nil:
+			hm.Kind = routeTable.MatchAbsent
+		default:
+			hm.Match = *h.StringMatch.match()
+		}
+		route.Headers = append(route.Headers, hm)
+	}
+
+	return route
+}
+
+func (r *Route) newSplit() (*routeTable.Split, error) {
+	var weights []routeTable.PoolWeight
+	for _, split := range r.Splits {
+		weights = append(weights, routeTable.PoolWeight{Pool: split.Pool, Weight: split.Weight})
+	}
+
+	return routeTable.NewSplit(weights, strings.ToLower(r.StickyKey))
+}
+
+// Whether a split built from r would be built the same from other
+func (r *Route) sameSplit(other *Route) bool {
+	return r.StickyKey == other.StickyKey && reflect.DeepEqual(r.Splits, other.Splits)
+}
+
+func (r *Route) newMirror() *routeTable.Mirror {
+	return &routeTable.Mirror{Pool: r.Mirror.Pool, Fraction: r.Mirror.Fraction}
+}
+
+// Whether a mirror built from r would be built the same from other
+func (r *Route) sameMirror(other *Route) bool {
+	return other.Mirror != nil && *r.Mirror == *other.Mirror
+}
+
+// nil if nothing is set
+func (m *StringMatch) match() *routeTable.Match {
+	switch {
+	case m.Exact != "":
+		return &routeTable.Match{Kind: routeTable.MatchExact, Value: m.Exact}
+	case m.Prefix != "":
+		return &routeTable.Match{Kind: routeTable.MatchPrefix, Value: m.Prefix}
+	case m.Regex != "":
+		return &routeTable.Match{Kind: routeTable.MatchRegex, Value: m.Regex}
+	}
+
+	return nil
+}
+
+// Every listener in the config, with LBPort first if it is set
+func (c *Config) listeners() []Listener {
+	var listeners []Listener
+	if c.LBPort != "" {
+		listeners = append(listeners, Listener{Network: "tcp", Address: fmt.Sprintf(":%s", c.LBPort)})
+	}
+	for _, l := range c.Listeners {
+		if l.Network == "" {
+			l.Network = "tcp"
+		}
+		listeners = append(listeners, l)
+	}
+
+	return listeners
+}
+
+// Where the admin service listens, "" if it is off
+func (c *Config) adminAddress() string {
+	if c.AdminPort != "" {
+		return net.JoinHostPort("localhost", c.AdminPort)
+	}
+
+	return c.AdminAddress
+}
+
+/*
+ * The certificate of a TLS listener. It is swapped on reload and handed out
+ * through tls.Config.GetCertificate, so new handshakes pick up the new one
+ * while established connections carry on.
+ */
+type certificate struct {
+	cert atomic.Value
+}
+
+func loadCertificate(l Listener) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(l.CertFile, l.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load certificate for %s: %v", l.Address, err)
+	}
+
+	return &cert, nil
+}
+
+func (c *certificate) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.cert.Load().(*tls.Certificate), nil
+}
+
+func (c *certificate) tlsConfig() *tls.Config {
+	return &tls.Config{GetCertificate: c.get}
+}
@@ -0,0 +1,615 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/open-lambda/load-balancer/balancer/routeTable"
+	"google.golang.org/grpc/codes"
+)
+
+/*
+ * Config is everything in a balancer config file. Files ending in .yaml or
+ * .yml are read as YAML, anything else as JSON; keys are the field names in
+ * both. The fields of the embedded Pool sit at the top level, so the old
+ * balancer.conf ({"Servers": [...], "LBPort": "...", "Consumers": n}) is
+ * still a valid config.
+ */
+type Config struct {
+	// The default pool, for requests no route matches; may be left without
+	// Servers if there are Routes
+	Pool
+	// More pools by name, see Routes
+	Pools map[string]Pool
+	// Tried in order, the first route matching a request picks its pool
+	Routes []Route
+	// Port to listen on for clients on every interface
+	LBPort string
+	// Goroutines handling client connections
+	Consumers int
+	// Addresses to listen on besides LBPort
+	Listeners []Listener
+	// Port of the admin service on localhost, off if neither this nor
+	// AdminAddress is set
+	AdminPort string
+	// Instead of AdminPort, the address the admin service listens on, e.g.
+	// ":50060" for every interface. The service can drain and remove
+	// servers, so only expose it to trusted networks.
+	AdminAddress string
+	// Registry cluster to pull request parsers from, and the services to pull
+	Registry []string
+	Services []string
+	// Optional request policies
+	Timeouts *Timeouts
+	Retries  *Retries
+	Hedging  *Hedging
+	// Optional, how connections to backends are shared; needs a restart to
+	// change
+	Connections *Connections
+}
+
+type Pool struct {
+	Servers []string
+	// One of "firsttwo" (default), "random", "ewma", "p2c", "roundrobin",
+	// "weighted", "hash" or "boundedhash"
+	Picker string
+	// Server weights for the "weighted" picker
+	Weights map[string]int
+	// Metadata key the hash pickers hash on, the method name if neither
+	// this nor HashField is set
+	HashKey string
+	// Instead of HashKey, a request field the hash pickers hash on, e.g.
+	// "user_id". Only methods with a parser pulled from the Registry have
+	// their fields decoded.
+	HashField string
+	// Points per server on the hash ring, serverPick.DefaultReplicas if 0
+	Replicas int
+	// Load cap of "boundedhash", serverPick.DefaultLoadFactor if 0
+	LoadFactor float64
+	// How fast "ewma" forgets old latencies, serverPick.DefaultDecay if 0
+	Decay Duration
+	// Optional, how the servers are health checked
+	HealthCheck *HealthCheck
+	// Optional, when servers failing requests are taken out of rotation
+	OutlierDetection *OutlierDetection
+}
+
+// See healthCheck.Config, fields left out keep healthCheck.DefaultConfig
+type HealthCheck struct {
+	Service            string
+	Interval           Duration
+	Timeout            Duration
+	UnhealthyThreshold int
+	HealthyThreshold   int
+}
+
+// See outlierDetect.Config, fields left out keep outlierDetect.DefaultConfig
+type OutlierDetection struct {
+	// Unlike the other fields, 0 is kept and turns the check off
+	ConsecutiveErrors  *int
+	ErrorRate          *float64
+	MinRequests        int
+	Interval           Duration
+	BaseEjectionTime   Duration
+	MaxEjectionTime    Duration
+	MaxEjectionPercent int
+	// Status code names, e.g. "UNAVAILABLE"
+	FailureCodes []string
+}
+
+/*
+ * A request takes the route if it matches everything the route gives. The
+ * method match sits at the top level, e.g. {"Prefix": "/helloworld.Greeter/",
+ * "Pool": "greeter"}; a route without one matches every method.
+ */
+type Route struct {
+	// Optional, needed to change Splits or see Mirror stats through the
+	// admin service
+	Name string
+	StringMatch
+	// Matched against the :authority of the request
+	Authority *StringMatch
+	// Conditions on the request metadata
+	Headers []HeaderMatch
+	// A name from Pools, or "default" for the top level pool
+	Pool string
+	// Instead of Pool, divides the route's requests between pools by weight
+	Splits []Split
+	// Optional, metadata key whose value keeps a client on the same split
+	// pool, e.g. "x-user-id"
+	StickyKey string
+	// Optional, copies some of the route's requests to a shadow pool. Only
+	// requests to methods known to be unary are copied: methods with a
+	// parser pulled from the Registry, or listed in Retries.
+	Mirror *Mirror
+}
+
+type Split struct {
+	Pool   string
+	Weight int
+}
+
+type Mirror struct {
+	Pool string
+	// Fraction of requests copied, more than 0 and at most 1
+	Fraction float64
+}
+
+// At most one of these may be set
+type StringMatch struct {
+	Exact  string
+	Prefix string
+	Regex  string
+}
+
+type HeaderMatch struct {
+	// Metadata key, e.g. "x-env"
+	Name string
+	// Matched against the values of the key, any value may match
+	StringMatch
+	// Instead of matching values, requires the key to be there (true) or
+	// not (false)
+	Present *bool
+}
+
+type Listener struct {
+	// "tcp" (default), "tcp4", "tcp6" or "unix"
+	Network string
+	Address string
+	// Serve TLS with this certificate if set. The files are read again on
+	// every reload, so certificates can be rotated without a restart.
+	CertFile string
+	KeyFile  string
+}
+
+// See balancer.TimeoutPolicy
+type Timeouts struct {
+	Default    Duration
+	Defaults   map[string]Duration
+	DefaultMax Duration
+	Max        map[string]Duration
+	Overhead   Duration
+}
+
+// See balancer.RetryPolicy
+type Retries struct {
+	Methods map[string]int
+	// Status code names, e.g. "RESOURCE_EXHAUSTED"
+	RetryableCodes []string
+	BudgetRatio    float64
+}
+
+// See balancer.HedgePolicy
+type Hedging struct {
+	// Full names of the idempotent methods
+	Methods     []string
+	Delay       Duration
+	Percentile  float64
+	MaxAttempts int
+}
+
+// See balancer.PoolPolicy
+type Connections struct {
+	MaxStreams  int
+	MaxAge      Duration
+	IdleTimeout Duration
+	// Connections kept open to every server of every pool
+	Warm int
+}
+
+// A time.Duration written as a string such as "1.5s" or "300ms"
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"1s\", got %s", data)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+var codeNames = map[string]codes.Code{
+	"OK":                  codes.OK,
+	"CANCELLED":           codes.Canceled,
+	"UNKNOWN":             codes.Unknown,
+	"INVALID_ARGUMENT":    codes.InvalidArgument,
+	"DEADLINE_EXCEEDED":   codes.DeadlineExceeded,
+	"NOT_FOUND":           codes.NotFound,
+	"ALREADY_EXISTS":      codes.AlreadyExists,
+	"PERMISSION_DENIED":   codes.PermissionDenied,
+	"RESOURCE_EXHAUSTED":  codes.ResourceExhausted,
+	"FAILED_PRECONDITION": codes.FailedPrecondition,
+	"ABORTED":             codes.Aborted,
+	"OUT_OF_RANGE":        codes.OutOfRange,
+	"UNIMPLEMENTED":       codes.Unimplemented,
+	"INTERNAL":            codes.Internal,
+	"UNAVAILABLE":         codes.Unavailable,
+	"DATA_LOSS":           codes.DataLoss,
+	"UNAUTHENTICATED":     codes.Unauthenticated,
+}
+
+// Reads and validates a config file
+func Load(filename string) (*Config, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	ext := strings.ToLower(filepath.Ext(filename))
+	conf, err := Parse(data, ext == ".yaml" || ext == ".yml")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	return conf, nil
+}
+
+// Decodes and validates a config, from YAML if isYAML is set
+func Parse(data []byte, isYAML bool) (*Config, error) {
+	if isYAML {
+		var err error
+		if data, err = yaml.YAMLToJSON(data); err != nil {
+			return nil, err
+		}
+	}
+
+	conf := &Config{}
+	if err := json.Unmarshal(data, conf); err != nil {
+		return nil, fmt.Errorf("could not decode config: %v", err)
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	return conf, nil
+}
+
+// Checks the config for mistakes, returning the first one found
+func (c *Config) Validate() error {
+	if c.Consumers <= 0 {
+		return fmt.Errorf("Consumers must be at least 1")
+	}
+	if c.LBPort == "" && len(c.Listeners) == 0 {
+		return fmt.Errorf("no LBPort or Listeners to accept clients on")
+	}
+	for i, l := range c.Listeners {
+		if err := l.validate(); err != nil {
+			return fmt.Errorf("Listeners[%d]: %v", i, err)
+		}
+	}
+	if c.AdminPort != "" && c.AdminAddress != "" {
+		return fmt.Errorf("only one of AdminPort and AdminAddress may be set")
+	}
+	if len(c.Services) > 0 && len(c.Registry) == 0 {
+		return fmt.Errorf("Services given without a Registry to pull them from")
+	}
+	if len(c.Servers) > 0 || len(c.Routes) == 0 {
+		if err := c.Pool.validate(); err != nil {
+			return err
+		}
+	}
+	for name, pool := range c.Pools {
+		if name == "" || name == routeTable.DefaultPool {
+			return fmt.Errorf("Pools: %q can't be used as a pool name", name)
+		}
+		if err := pool.validate(); err != nil {
+			return fmt.Errorf("Pools[%s]: %v", name, err)
+		}
+	}
+	names := make(map[string]bool)
+	for i, route := range c.Routes {
+		if err := c.validateRoute(&route); err != nil {
+			return fmt.Errorf("Routes[%d]: %v", i, err)
+		}
+		if route.Name != "" && names[route.Name] {
+			return fmt.Errorf("Routes[%d]: name %s is used twice", i, route.Name)
+		}
+		names[route.Name] = true
+	}
+	if c.Timeouts != nil {
+		if err := c.Timeouts.validate(); err != nil {
+			return fmt.Errorf("Timeouts: %v", err)
+		}
+	}
+	if c.Retries != nil {
+		if err := c.Retries.validate(); err != nil {
+			return fmt.Errorf("Retries: %v", err)
+		}
+	}
+	if c.Hedging != nil {
+		if err := c.Hedging.validate(); err != nil {
+			return fmt.Errorf("Hedging: %v", err)
+		}
+	}
+	if c.Connections != nil {
+		if err := c.Connections.validate(); err != nil {
+			return fmt.Errorf("Connections: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) validateRoute(r *Route) error {
+	if err := r.StringMatch.validate(); err != nil {
+		return err
+	}
+	if r.Authority != nil {
+		if err := r.Authority.validate(); err != nil {
+			return fmt.Errorf("Authority: %v", err)
+		}
+		if r.Authority.empty() {
+			return fmt.Errorf("Authority: no Exact, Prefix or Regex")
+		}
+	}
+	for i, h := range r.Headers {
+		if err := h.validate(); err != nil {
+			return fmt.Errorf("Headers[%d]: %v", i, err)
+		}
+	}
+
+	pools := c.pools()
+	if r.Mirror != nil {
+		if _, ok := pools[r.Mirror.Pool]; !ok {
+			return fmt.Errorf("Mirror: unknown pool %q", r.Mirror.Pool)
+		}
+		if r.Mirror.Fraction <= 0 || r.Mirror.Fraction > 1 {
+			return fmt.Errorf("Mirror: Fraction must be more than 0 and at most 1")
+		}
+	}
+	if len(r.Splits) == 0 {
+		if r.StickyKey != "" {
+			return fmt.Errorf("StickyKey needs Splits")
+		}
+		if _, ok := pools[r.Pool]; !ok {
+			return fmt.Errorf("unknown pool %q", r.Pool)
+		}
+		return nil
+	}
+
+	if r.Pool != "" {
+		return fmt.Errorf("only one of Pool and Splits may be set")
+	}
+	total := 0
+	seen := make(map[string]bool)
+	for _, split := range r.Splits {
+		if _, ok := pools[split.Pool]; !ok {
+			return fmt.Errorf("Splits: unknown pool %q", split.Pool)
+		}
+		if seen[split.Pool] {
+			return fmt.Errorf("Splits: pool %s is listed twice", split.Pool)
+		}
+		seen[split.Pool] = true
+		if split.Weight < 0 {
+			return fmt.Errorf("Splits: weight of %s is negative", split.Pool)
+		}
+		total += split.Weight
+	}
+	if total == 0 {
+		return fmt.Errorf("Splits: all weights are 0")
+	}
+
+	return nil
+}
+
+func (m *StringMatch) empty() bool {
+	return m.Exact == "" && m.Prefix == "" && m.Regex == ""
+}
+
+func (m *StringMatch) validate() error {
+	set := 0
+	for _, match := range []string{m.Exact, m.Prefix, m.Regex} {
+		if match != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return fmt.Errorf("only one of Exact, Prefix and Regex may be set")
+	}
+	if m.Regex != "" {
+		if _, err := regexp.Compile(m.Regex); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (h *HeaderMatch) validate() error {
+	if h.Name == "" {
+		return fmt.Errorf("no Name")
+	}
+	if err := h.StringMatch.validate(); err != nil {
+		return err
+	}
+	if h.StringMatch.empty() == (h.Present == nil) {
+		return fmt.Errorf("needs exactly one of Exact, Prefix, Regex and Present")
+	}
+
+	return nil
+}
+
+func (l *Listener) validate() error {
+	switch l.Network {
+	case "", "tcp", "tcp4", "tcp6", "unix":
+	default:
+		return fmt.Errorf("unknown network %q", l.Network)
+	}
+	if l.Address == "" {
+		return fmt.Errorf("no Address")
+	}
+	if (l.CertFile == "") != (l.KeyFile == "") {
+		return fmt.Errorf("CertFile and KeyFile must be given together")
+	}
+
+	return nil
+}
+
+func (p *Pool) validate() error {
+	if len(p.Servers) == 0 {
+		return fmt.Errorf("no Servers")
+	}
+	seen := make(map[string]bool)
+	for _, server := range p.Servers {
+		if seen[server] {
+			return fmt.Errorf("server %s is listed twice", server)
+		}
+		seen[server] = true
+	}
+
+	switch p.Picker {
+	case "", "firsttwo", "random", "ewma", "p2c", "roundrobin", "weighted", "hash", "boundedhash":
+	default:
+		return fmt.Errorf("unknown Picker %q", p.Picker)
+	}
+	for server, weight := range p.Weights {
+		if !seen[server] {
+			return fmt.Errorf("weight given for unknown server %s", server)
+		}
+		if weight < 0 {
+			return fmt.Errorf("weight of %s is negative", server)
+		}
+	}
+	if p.Replicas < 0 {
+		return fmt.Errorf("Replicas is negative")
+	}
+	if p.LoadFactor != 0 && p.LoadFactor < 1 {
+		return fmt.Errorf("LoadFactor must be at least 1")
+	}
+	if p.Decay.Duration < 0 {
+		return fmt.Errorf("Decay is negative")
+	}
+	if p.HashKey != "" && p.HashField != "" {
+		return fmt.Errorf("only one of HashKey and HashField may be set")
+	}
+	if p.HealthCheck != nil {
+		if err := p.HealthCheck.validate(); err != nil {
+			return fmt.Errorf("HealthCheck: %v", err)
+		}
+	}
+	if p.OutlierDetection != nil {
+		if err := p.OutlierDetection.validate(); err != nil {
+			return fmt.Errorf("OutlierDetection: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (h *HealthCheck) validate() error {
+	if h.Interval.Duration < 0 || h.Timeout.Duration < 0 {
+		return fmt.Errorf("Interval and Timeout can't be negative")
+	}
+	if h.UnhealthyThreshold < 0 || h.HealthyThreshold < 0 {
+		return fmt.Errorf("UnhealthyThreshold and HealthyThreshold can't be negative")
+	}
+
+	return nil
+}
+
+func (o *OutlierDetection) validate() error {
+	if o.ConsecutiveErrors != nil && *o.ConsecutiveErrors < 0 {
+		return fmt.Errorf("ConsecutiveErrors is negative")
+	}
+	if o.ErrorRate != nil && (*o.ErrorRate < 0 || *o.ErrorRate > 1) {
+		return fmt.Errorf("ErrorRate must be between 0 and 1")
+	}
+	if o.MinRequests < 0 {
+		return fmt.Errorf("MinRequests is negative")
+	}
+	if o.Interval.Duration < 0 || o.BaseEjectionTime.Duration < 0 || o.MaxEjectionTime.Duration < 0 {
+		return fmt.Errorf("Interval, BaseEjectionTime and MaxEjectionTime can't be negative")
+	}
+	if o.MaxEjectionPercent < 0 || o.MaxEjectionPercent > 100 {
+		return fmt.Errorf("MaxEjectionPercent must be between 0 and 100")
+	}
+	for _, name := range o.FailureCodes {
+		if _, ok := codeNames[name]; !ok {
+			return fmt.Errorf("unknown status code %q", name)
+		}
+	}
+
+	return nil
+}
+
+func (t *Timeouts) validate() error {
+	durations := map[string]Duration{
+		"Default":    t.Default,
+		"DefaultMax": t.DefaultMax,
+		"Overhead":   t.Overhead,
+	}
+	for method, d := range t.Defaults {
+		durations["Defaults["+method+"]"] = d
+	}
+	for method, d := range t.Max {
+		durations["Max["+method+"]"] = d
+	}
+	for name, d := range durations {
+		if d.Duration < 0 {
+			return fmt.Errorf("%s is negative", name)
+		}
+	}
+
+	return nil
+}
+
+func (r *Retries) validate() error {
+	for method, attempts := range r.Methods {
+		if attempts < 1 {
+			return fmt.Errorf("%s needs at least 1 attempt", method)
+		}
+	}
+	for _, name := range r.RetryableCodes {
+		if _, ok := codeNames[name]; !ok {
+			return fmt.Errorf("unknown status code %q", name)
+		}
+	}
+	if r.BudgetRatio < 0 || r.BudgetRatio > 1 {
+		return fmt.Errorf("BudgetRatio must be between 0 and 1")
+	}
+
+	return nil
+}
+
+func (h *Hedging) validate() error {
+	if h.MaxAttempts < 1 {
+		return fmt.Errorf("MaxAttempts must be at least 1")
+	}
+	if h.Percentile < 0 || h.Percentile >= 1 {
+		return fmt.Errorf("Percentile must be at least 0 and below 1")
+	}
+	// Percentile only takes over once a method has enough samples
+	if h.Delay.Duration <= 0 {
+		return fmt.Errorf("Delay must be positive")
+	}
+
+	return nil
+}
+
+func (c *Connections) validate() error {
+	if c.MaxStreams < 0 || c.Warm < 0 {
+		return fmt.Errorf("MaxStreams and Warm can't be negative")
+	}
+	if c.MaxAge.Duration < 0 || c.IdleTimeout.Duration < 0 {
+		return fmt.Errorf("MaxAge and IdleTimeout can't be negative")
+	}
+
+	return nil
+}
@@ -0,0 +1,362 @@
+package config
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A config with a default pool, a second pool and a route to it
+func testConfig() *Config {
+	return &Config{
+		Pool:      Pool{Servers: []string{"10.0.0.1:50051", "10.0.0.2:50051"}},
+		Pools:     map[string]Pool{"orders": {Servers: []string{"10.0.1.1:50051"}}},
+		Routes:    []Route{{StringMatch: StringMatch{Prefix: "/shop.Orders/"}, Pool: "orders"}},
+		LBPort:    "50050",
+		Consumers: 4,
+	}
+}
+
+func intPtr(i int) *int                 { return &i }
+func floatPtr(f float64) *float64       { return &f }
+func boolPtr(b bool) *bool              { return &b }
+func duration(d time.Duration) Duration { return Duration{d} }
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(c *Config)
+		// Part of the error, empty if the config is valid
+		wantErr string
+	}{
+		{
+			name: "valid",
+			edit: func(c *Config) {},
+		},
+		{
+			name:    "no consumers",
+			edit:    func(c *Config) { c.Consumers = 0 },
+			wantErr: "Consumers",
+		},
+		{
+			name:    "nothing to listen on",
+			edit:    func(c *Config) { c.LBPort = "" },
+			wantErr: "no LBPort or Listeners",
+		},
+		{
+			name: "listeners instead of LBPort",
+			edit: func(c *Config) {
+				c.LBPort = ""
+				c.Listeners = []Listener{{Network: "unix", Address: "/run/lb.sock"}}
+			},
+		},
+		{
+			name:    "listener with unknown network",
+			edit:    func(c *Config) { c.Listeners = []Listener{{Network: "udp", Address: ":53"}} },
+			wantErr: "Listeners[0]: unknown network",
+		},
+		{
+			name:    "listener with cert but no key",
+			edit:    func(c *Config) { c.Listeners = []Listener{{Address: ":443", CertFile: "lb.crt"}} },
+			wantErr: "CertFile and KeyFile",
+		},
+		{
+			name: "admin port and address",
+			edit: func(c *Config) {
+				c.AdminPort = "50060"
+				c.AdminAddress = ":50060"
+			},
+			wantErr: "AdminPort and AdminAddress",
+		},
+		{
+			name:    "services without registry",
+			edit:    func(c *Config) { c.Services = []string{"shop.Orders"} },
+			wantErr: "Registry",
+		},
+		{
+			name: "routes without a default pool",
+			edit: func(c *Config) {
+				c.Servers = nil
+				c.Routes[0].StringMatch = StringMatch{}
+			},
+		},
+		{
+			name:    "no servers and no routes",
+			edit:    func(c *Config) { c.Servers, c.Routes = nil, nil },
+			wantErr: "no Servers",
+		},
+		{
+			name:    "server listed twice",
+			edit:    func(c *Config) { c.Servers = append(c.Servers, c.Servers[0]) },
+			wantErr: "listed twice",
+		},
+		{
+			name:    "unknown picker",
+			edit:    func(c *Config) { c.Picker = "fastest" },
+			wantErr: "unknown Picker",
+		},
+		{
+			name:    "weight for unknown server",
+			edit:    func(c *Config) { c.Weights = map[string]int{"10.0.0.9:50051": 2} },
+			wantErr: "unknown server",
+		},
+		{
+			name:    "negative weight",
+			edit:    func(c *Config) { c.Weights = map[string]int{"10.0.0.1:50051": -1} },
+			wantErr: "negative",
+		},
+		{
+			name:    "load factor below 1",
+			edit:    func(c *Config) { c.LoadFactor = 0.5 },
+			wantErr: "LoadFactor",
+		},
+		{
+			name: "hash key and field",
+			edit: func(c *Config) {
+				c.HashKey = "x-user"
+				c.HashField = "user_id"
+			},
+			wantErr: "HashKey and HashField",
+		},
+		{
+			name:    "negative health check interval",
+			edit:    func(c *Config) { c.HealthCheck = &HealthCheck{Interval: duration(-time.Second)} },
+			wantErr: "HealthCheck",
+		},
+		{
+			name: "outlier detection",
+			edit: func(c *Config) {
+				c.OutlierDetection = &OutlierDetection{
+					ConsecutiveErrors: intPtr(0),
+					ErrorRate:         floatPtr(0.5),
+					FailureCodes:      []string{"UNAVAILABLE"},
+				}
+			},
+		},
+		{
+			name:    "error rate above 1",
+			edit:    func(c *Config) { c.OutlierDetection = &OutlierDetection{ErrorRate: floatPtr(2)} },
+			wantErr: "ErrorRate",
+		},
+		{
+			name:    "unknown failure code",
+			edit:    func(c *Config) { c.OutlierDetection = &OutlierDetection{FailureCodes: []string{"GONE"}} },
+			wantErr: "unknown status code",
+		},
+		{
+			name:    "pool called default",
+			edit:    func(c *Config) { c.Pools["default"] = Pool{Servers: []string{"10.0.2.1:50051"}} },
+			wantErr: "can't be used as a pool name",
+		},
+		{
+			name:    "bad named pool",
+			edit:    func(c *Config) { c.Pools["orders"] = Pool{} },
+			wantErr: "Pools[orders]: no Servers",
+		},
+		{
+			name:    "route to unknown pool",
+			edit:    func(c *Config) { c.Routes[0].Pool = "users" },
+			wantErr: "Routes[0]: unknown pool",
+		},
+		{
+			name: "route to the default pool",
+			edit: func(c *Config) { c.Routes[0].Pool = "default" },
+		},
+		{
+			name:    "two method matches",
+			edit:    func(c *Config) { c.Routes[0].Exact = "/shop.Orders/Get" },
+			wantErr: "only one of Exact, Prefix and Regex",
+		},
+		{
+			name:    "bad regex",
+			edit:    func(c *Config) { c.Routes[0].StringMatch = StringMatch{Regex: "("} },
+			wantErr: "Routes[0]",
+		},
+		{
+			name:    "empty authority",
+			edit:    func(c *Config) { c.Routes[0].Authority = &StringMatch{} },
+			wantErr: "Authority",
+		},
+		{
+			name: "header regex and present",
+			edit: func(c *Config) {
+				c.Routes[0].Headers = []HeaderMatch{
+					{Name: "x-env", StringMatch: StringMatch{Regex: "^canary"}},
+					{Name: "x-debug", Present: boolPtr(false)},
+				}
+			},
+		},
+		{
+			name: "header with value and present",
+			edit: func(c *Config) {
+				c.Routes[0].Headers = []HeaderMatch{
+					{Name: "x-env", StringMatch: StringMatch{Exact: "canary"}, Present: boolPtr(true)},
+				}
+			},
+			wantErr: "Headers[0]",
+		},
+		{
+			name:    "header without name",
+			edit:    func(c *Config) { c.Routes[0].Headers = []HeaderMatch{{Present: boolPtr(true)}} },
+			wantErr: "no Name",
+		},
+		{
+			name: "splits",
+			edit: func(c *Config) {
+				c.Routes[0].Pool = ""
+				c.Routes[0].Splits = []Split{{"default", 95}, {"orders", 5}}
+				c.Routes[0].StickyKey = "x-user"
+			},
+		},
+		{
+			name:    "pool and splits",
+			edit:    func(c *Config) { c.Routes[0].Splits = []Split{{"orders", 1}} },
+			wantErr: "only one of Pool and Splits",
+		},
+		{
+			name: "split pool listed twice",
+			edit: func(c *Config) {
+				c.Routes[0].Pool = ""
+				c.Routes[0].Splits = []Split{{"orders", 1}, {"orders", 1}}
+			},
+			wantErr: "listed twice",
+		},
+		{
+			name: "splits without weight",
+			edit: func(c *Config) {
+				c.Routes[0].Pool = ""
+				c.Routes[0].Splits = []Split{{"default", 0}, {"orders", 0}}
+			},
+			wantErr: "all weights are 0",
+		},
+		{
+			name:    "sticky key without splits",
+			edit:    func(c *Config) { c.Routes[0].StickyKey = "x-user" },
+			wantErr: "StickyKey needs Splits",
+		},
+		{
+			name:    "mirror fraction 0",
+			edit:    func(c *Config) { c.Routes[0].Mirror = &Mirror{Pool: "default"} },
+			wantErr: "Fraction",
+		},
+		{
+			name:    "mirror to unknown pool",
+			edit:    func(c *Config) { c.Routes[0].Mirror = &Mirror{Pool: "shadow", Fraction: 0.1} },
+			wantErr: "Mirror: unknown pool",
+		},
+		{
+			name: "route name used twice",
+			edit: func(c *Config) {
+				c.Routes[0].Name = "orders"
+				c.Routes = append(c.Routes, Route{Name: "orders", Pool: "default"})
+			},
+			wantErr: "Routes[1]: name orders is used twice",
+		},
+		{
+			name:    "negative timeout",
+			edit:    func(c *Config) { c.Timeouts = &Timeouts{Defaults: map[string]Duration{"/a/b": duration(-1)}} },
+			wantErr: "Timeouts: Defaults[/a/b] is negative",
+		},
+		{
+			name:    "retries without attempts",
+			edit:    func(c *Config) { c.Retries = &Retries{Methods: map[string]int{"/a/b": 0}} },
+			wantErr: "Retries",
+		},
+		{
+			name:    "hedging without delay",
+			edit:    func(c *Config) { c.Hedging = &Hedging{MaxAttempts: 2} },
+			wantErr: "Hedging: Delay",
+		},
+		{
+			name:    "negative warm connections",
+			edit:    func(c *Config) { c.Connections = &Connections{Warm: -1} },
+			wantErr: "Connections",
+		},
+	}
+
+	for _, test := range tests {
+		conf := testConfig()
+		test.edit(conf)
+		err := conf.Validate()
+		switch {
+		case test.wantErr == "" && err != nil:
+			t.Errorf("%s: %v", test.name, err)
+		case test.wantErr != "" && err == nil:
+			t.Errorf("%s: no error, want %q", test.name, test.wantErr)
+		case test.wantErr != "" && !strings.Contains(err.Error(), test.wantErr):
+			t.Errorf("%s: got error %q, want %q", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	// The old balancer.conf is still a valid config
+	conf, err := Parse([]byte(`{"Servers": ["10.0.0.1:50051"], "LBPort": "50050", "Consumers": 2}`), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conf.Servers) != 1 || conf.LBPort != "50050" || conf.Consumers != 2 {
+		t.Errorf("got %+v", conf)
+	}
+
+	yaml := "Servers: [10.0.0.1:50051]\nLBPort: \"50050\"\nConsumers: 2\nDecay: 5s\n"
+	if conf, err = Parse([]byte(yaml), true); err != nil {
+		t.Fatal(err)
+	}
+	if conf.Decay.Duration != 5*time.Second {
+		t.Errorf("got Decay %v, want 5s", conf.Decay)
+	}
+
+	if _, err := Parse([]byte(`{"Servers": ["a"], "LBPort": "1", "Consumers": 1, "Decay": 5}`), false); err == nil {
+		t.Errorf("Decay given as a number: no error")
+	}
+	if _, err := Parse([]byte(`{"Servers": ["a"], "LBPort": "1"}`), false); err == nil {
+		t.Errorf("no Consumers: no error")
+	}
+}
+
+func TestLoadExample(t *testing.T) {
+	if _, err := Load("example.yaml"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunStopsPoolsWhenAdminFails(t *testing.T) {
+	// Something else already has the admin address
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "balancer.json")
+	data := `{"Servers": ["backend.invalid:1"], "LBPort": "0", "Consumers": 1, "AdminAddress": "` + taken.Addr().String() + `"}`
+	if err := ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRunner(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Run(); err == nil {
+		t.Fatal("Run with the admin address taken: no error")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, p := range r.pools {
+		if p.running {
+			t.Errorf("pool %q left running", name)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package config
+
+import (
+	"reflect"
+
+	"github.com/open-lambda/load-balancer/balancer"
+	"github.com/open-lambda/load-balancer/balancer/healthCheck"
+	"github.com/open-lambda/load-balancer/balancer/outlierDetect"
+	"github.com/open-lambda/load-balancer/balancer/routeTable"
+	"github.com/open-lambda/load-balancer/balancer/serverPick"
+	"github.com/open-lambda/load-balancer/balancer/serverSet"
+)
+
+// The running backends of one pool and what keeps them healthy
+type pool struct {
+	conf     Pool
+	set      *serverSet.Set
+	chooser  serverPick.ServerPicker
+	checker  *healthCheck.Checker
+	detector *outlierDetect.Detector
+	running  bool
+	// How health checks reach the servers, the balancer's dialer
+	dial balancer.DialFunc
+}
+
+// Sets up a pool, nothing runs until start is called
+func newPool(conf Pool, dial balancer.DialFunc) *pool {
+	p := &pool{
+		conf: conf,
+		set:  serverSet.NewSet(conf.Servers),
+		dial: dial,
+	}
+	for server, weight := range conf.Weights {
+		p.set.SetWeight(server, weight)
+	}
+	p.chooser = conf.NewPicker(conf.Servers)
+	p.watch(p.chooser)
+	p.checker = p.newChecker(conf.HealthCheck)
+	p.detector = outlierDetect.NewDetector(p.set, conf.OutlierDetection.config())
+
+	return p
+}
+
+func (p *pool) newChecker(hc *HealthCheck) *healthCheck.Checker {
+	conf := hc.config()
+	conf.Dial = p.dial
+
+	return healthCheck.NewChecker(p.set, conf)
+}
+
+// Every picker NewPicker builds takes server changes, see serverPick.ServerSetter
+func (p *pool) watch(chooser serverPick.ServerPicker) {
+	if w, ok := chooser.(serverSet.Watcher); ok {
+		p.set.Watch(w)
+	}
+}
+
+func (p *pool) unwatch(chooser serverPick.ServerPicker) {
+	if w, ok := chooser.(serverSet.Watcher); ok {
+		p.set.Unwatch(w)
+	}
+}
+
+func (p *pool) start() {
+	p.running = true
+	go p.checker.Run()
+	go p.detector.Run()
+}
+
+func (p *pool) stop() {
+	p.running = false
+	p.checker.Stop()
+	p.detector.Stop()
+}
+
+// The pool as the route table sees it
+func (p *pool) route(name string) *routeTable.Pool {
+	return &routeTable.Pool{
+		Name:     name,
+		Picker:   serverPick.Adapt(p.chooser),
+		Outliers: p.detector,
+	}
+}
+
+// A changed config for a running pool, worked out by prepare
+type poolChange struct {
+	conf    Pool
+	chooser serverPick.ServerPicker
+	// Whether chooser replaces the pool's picker
+	replace bool
+	// Replacements for the pool's, nil if their settings didn't change
+	checker  *healthCheck.Checker
+	detector *outlierDetect.Detector
+}
+
+// The pool as the route table sees it once c is applied
+func (c *poolChange) route(p *pool, name string) *routeTable.Pool {
+	rp := &routeTable.Pool{
+		Name:     name,
+		Picker:   serverPick.Adapt(c.chooser),
+		Outliers: p.detector,
+	}
+	if c.detector != nil {
+		rp.Outliers = c.detector
+	}
+
+	return rp
+}
+
+/*
+ * Works out a changed config without touching the running pool. The picker,
+ * health checker and outlier detector are only replaced if their settings
+ * changed, so they keep what they learned about the servers otherwise.
+ */
+func (p *pool) prepare(conf Pool) *poolChange {
+	c := &poolChange{conf: conf, chooser: p.chooser}
+	if !conf.samePicker(&p.conf) {
+		c.chooser = conf.NewPicker(p.set.Available())
+		c.replace = true
+	}
+	if !reflect.DeepEqual(conf.HealthCheck, p.conf.HealthCheck) {
+		c.checker = p.newChecker(conf.HealthCheck)
+	}
+	if !reflect.DeepEqual(conf.OutlierDetection, p.conf.OutlierDetection) {
+		c.detector = outlierDetect.NewDetector(p.set, conf.OutlierDetection.config())
+	}
+
+	return c
+}
+
+/*
+ * Brings the pool in line with a change from prepare. Only servers and
+ * weights that changed in the file are touched, so changes made through the
+ * admin service survive reloads.
+ */
+func (p *pool) update(c *poolChange) {
+	old, conf := p.conf, c.conf
+
+	inOld := make(map[string]bool)
+	for _, server := range old.Servers {
+		inOld[server] = true
+	}
+	inNew := make(map[string]bool)
+	for _, server := range conf.Servers {
+		inNew[server] = true
+		if !inOld[server] {
+			// Already there if it was added through the admin service
+			p.set.Add(server)
+		}
+	}
+	for _, server := range old.Servers {
+		if !inNew[server] {
+			p.set.Remove(server)
+		}
+	}
+
+	for _, server := range conf.Servers {
+		weight, ok := conf.Weights[server]
+		oldWeight, hadWeight := old.Weights[server]
+		switch {
+		case ok && (!hadWeight || weight != oldWeight || !inOld[server]):
+			p.set.SetWeight(server, weight)
+		case !ok && hadWeight:
+			p.set.SetWeight(server, 1)
+		}
+	}
+
+	if c.replace {
+		// Watching hands the new picker the servers as they are now
+		p.watch(c.chooser)
+		p.unwatch(p.chooser)
+		p.chooser = c.chooser
+	}
+	// The replacements start afresh, so nothing stays out of rotation on
+	// the word of the old ones
+	if c.checker != nil {
+		p.checker.Stop()
+		for _, server := range p.set.Servers() {
+			p.set.SetHealthy(server, true)
+		}
+		p.checker = c.checker
+		if p.running {
+			go p.checker.Run()
+		}
+	}
+	if c.detector != nil {
+		p.detector.Stop()
+		for _, server := range p.set.Servers() {
+			p.set.SetEjected(server, false)
+		}
+		p.detector = c.detector
+		if p.running {
+			go p.detector.Run()
+		}
+	}
+	p.conf = conf
+}
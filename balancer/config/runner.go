@@ -0,0 +1,500 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/open-lambda/load-balancer/balancer"
+	"github.com/open-lambda/load-balancer/balancer/admin"
+	"github.com/open-lambda/load-balancer/balancer/msgPeek"
+	lbreg "github.com/open-lambda/load-balancer/balancer/registry"
+	"github.com/open-lambda/load-balancer/balancer/routeTable"
+	"github.com/open-lambda/load-balancer/balancer/serverSet"
+	"golang.org/x/net/context"
+)
+
+/*
+ * Runner runs a balancer set up from a config file, along with health
+ * checking and outlier detection for every pool and the admin service, and
+ * applies changes to the file while the balancer runs. A reload that fails
+ * leaves the running config untouched.
+ */
+type Runner struct {
+	Balancer *balancer.LoadBalancer
+
+	filename string
+	parsers  *msgPeek.Table
+	admin    *admin.Server
+	adminLis net.Listener
+
+	mu      sync.Mutex
+	conf    *Config
+	pools   map[string]*pool
+	running bool
+	// Certificates of the TLS listeners, by address
+	certs   map[string]*certificate
+	modTime time.Time
+	pulled  map[string]bool
+	// Splits and mirrors of named routes, kept over reloads that leave
+	// them alone so weights set through the admin service and mirror stats
+	// stay
+	named map[string]*namedRoute
+
+	done chan struct{}
+	once sync.Once
+}
+
+/*
+ * Sets up a runner for the config in filename. opts are passed on to the
+ * balancer; a dialer given with balancer.WithDialer is used for health checks
+ * too.
+ */
+func NewRunner(filename string, opts ...balancer.Option) (*Runner, error) {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	conf, err := Load(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Runner{
+		filename: filename,
+		parsers:  msgPeek.NewTable(),
+		conf:     conf,
+		pools:    make(map[string]*pool),
+		certs:    make(map[string]*certificate),
+		modTime:  fi.ModTime(),
+		pulled:   make(map[string]bool),
+		named:    make(map[string]*namedRoute),
+		done:     make(chan struct{}),
+	}
+	lb := new(balancer.LoadBalancer)
+	opts = append([]balancer.Option{balancer.WithPooling(conf.Connections.policy())}, opts...)
+	// The picker is set along with the other settings below
+	lb.InitPicker("", nil, conf.Consumers, opts...)
+
+	routePools := make(map[string]*routeTable.Pool)
+	for name, pc := range conf.pools() {
+		p := newPool(pc, lb.Dial)
+		r.pools[name] = p
+		routePools[name] = p.route(name)
+	}
+	table, named, err := r.routes(conf, routePools)
+	if err != nil {
+		return nil, err
+	}
+	r.named = named
+	r.admin = admin.NewServer(r.sets())
+	r.admin.SetRoutes(table)
+	settings := conf.settings(table)
+
+	parsers, err := pullParsers(conf.Registry, conf.Services, r.pulled)
+	if err != nil {
+		return nil, err
+	}
+	r.addParsers(parsers)
+
+	for _, l := range conf.listeners() {
+		bl := &balancer.Listener{Network: l.Network, Address: l.Address}
+		if l.CertFile != "" {
+			cert, err := loadCertificate(l)
+			if err != nil {
+				return nil, err
+			}
+			c := &certificate{}
+			c.cert.Store(cert)
+			r.certs[l.Address] = c
+			bl.TLS = c.tlsConfig()
+		}
+		lb.Listeners = append(lb.Listeners, bl)
+	}
+	lb.Settings = settings
+	lb.Parsers = r.parsers
+	r.Balancer = lb
+
+	return r, nil
+}
+
+/*
+ * Starts health checking, outlier detection and the admin service, then runs
+ * the balancer until it fails or Shutdown is called, see LoadBalancer.Run.
+ */
+func (r *Runner) Run() error {
+	r.mu.Lock()
+	select {
+	case <-r.done:
+		// Pools started now would never be stopped
+		r.mu.Unlock()
+		return balancer.ErrShutdown
+	default:
+	}
+	r.running = true
+	for _, p := range r.pools {
+		p.start()
+	}
+	r.Balancer.WarmBackends(r.servers())
+	// A reload may replace conf once the lock is released
+	addr := r.conf.adminAddress()
+	r.mu.Unlock()
+
+	if addr != "" {
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			r.mu.Lock()
+			r.stopPools()
+			r.mu.Unlock()
+			return err
+		}
+
+		r.mu.Lock()
+		if !r.running {
+			// Shutdown got here first and had no listener to close
+			r.mu.Unlock()
+			lis.Close()
+			return balancer.ErrShutdown
+		}
+		r.adminLis = lis
+		r.mu.Unlock()
+		go func() {
+			if err := r.admin.Serve(lis); err != nil {
+				log.Printf("admin service stopped: %v", err)
+			}
+		}()
+	}
+
+	return r.Balancer.Run()
+}
+
+// Stops everything Run started, draining the balancer's connections
+func (r *Runner) Shutdown(ctx context.Context) error {
+	r.once.Do(func() {
+		close(r.done)
+		r.mu.Lock()
+		r.stopPools()
+		if r.adminLis != nil {
+			r.adminLis.Close()
+		}
+		r.mu.Unlock()
+	})
+
+	return r.Balancer.Shutdown(ctx)
+}
+
+// Stops health checking and outlier detection of every pool, must hold r.mu
+func (r *Runner) stopPools() {
+	r.running = false
+	for _, p := range r.pools {
+		if p.running {
+			p.stop()
+		}
+	}
+}
+
+/*
+ * Reloads the config on SIGHUP and whenever the file's modification time
+ * changes, checked every interval, until Shutdown is called.
+ */
+func (r *Runner) Watch(interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-hup:
+			r.reload("SIGHUP")
+		case <-ticker.C:
+			if r.changed() {
+				r.reload("file change")
+			}
+		case <-r.done:
+			return
+		}
+	}
+}
+
+func (r *Runner) reload(reason string) {
+	if err := r.Reload(); err != nil {
+		log.Printf("config reload on %s rejected, keeping the running config: %v", reason, err)
+		return
+	}
+	log.Printf("config reloaded from %s on %s", r.filename, reason)
+}
+
+// Whether the file was modified since it was last read
+func (r *Runner) changed() bool {
+	fi, err := os.Stat(r.filename)
+	if err != nil {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return !fi.ModTime().Equal(r.modTime)
+}
+
+// Reads the config file again and applies it
+func (r *Runner) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Even a broken file counts as seen so it isn't retried on every poll
+	if fi, err := os.Stat(r.filename); err == nil {
+		r.modTime = fi.ModTime()
+	}
+	conf, err := Load(r.filename)
+	if err != nil {
+		return err
+	}
+
+	return r.apply(conf)
+}
+
+/*
+ * Replaces the running config with conf, must hold r.mu. Everything that can
+ * fail happens before anything is changed, so a rejected config leaves the
+ * running one as it was.
+ */
+func (r *Runner) apply(conf *Config) error {
+	old := r.conf
+	if err := needsRestart(old, conf); err != nil {
+		return err
+	}
+
+	certs := make(map[string]*tls.Certificate)
+	for _, l := range conf.listeners() {
+		if l.CertFile == "" {
+			continue
+		}
+		cert, err := loadCertificate(l)
+		if err != nil {
+			return err
+		}
+		certs[l.Address] = cert
+	}
+	parsers, err := pullParsers(conf.Registry, conf.Services, r.pulled)
+	if err != nil {
+		return err
+	}
+
+	// New pools only start once the config is applied
+	changes := make(map[string]*poolChange)
+	added := make(map[string]*pool)
+	routePools := make(map[string]*routeTable.Pool)
+	for name, pc := range conf.pools() {
+		if p, ok := r.pools[name]; ok {
+			c := p.prepare(pc)
+			changes[name] = c
+			routePools[name] = c.route(p, name)
+			continue
+		}
+		p := newPool(pc, r.Balancer.Dial)
+		added[name] = p
+		routePools[name] = p.route(name)
+	}
+	table, named, err := r.routes(conf, routePools)
+	if err != nil {
+		return err
+	}
+
+	for addr, cert := range certs {
+		r.certs[addr].cert.Store(cert)
+	}
+	r.addParsers(parsers)
+
+	for name, p := range r.pools {
+		if c, ok := changes[name]; ok {
+			p.update(c)
+			continue
+		}
+		p.stop()
+		delete(r.pools, name)
+	}
+	for name, p := range added {
+		if r.running {
+			p.start()
+		}
+		r.pools[name] = p
+	}
+	r.admin.SetPools(r.sets())
+	r.named = named
+	r.admin.SetRoutes(table)
+	if r.running {
+		r.Balancer.WarmBackends(r.servers())
+	}
+
+	r.Balancer.Reconfigure(conf.settings(table))
+	r.conf = conf
+
+	return nil
+}
+
+// What a named route keeps over reloads
+type namedRoute struct {
+	split  *routeTable.Split
+	mirror *routeTable.Mirror
+}
+
+/*
+ * Builds the route table for conf over pools, along with what its named
+ * routes keep. Splits and mirrors are reused from the running config where
+ * they didn't change. Nothing of the runner is changed.
+ */
+func (r *Runner) routes(conf *Config, pools map[string]*routeTable.Pool) (*routeTable.Table, map[string]*namedRoute, error) {
+	var list []*routeTable.Pool
+	for _, p := range pools {
+		list = append(list, p)
+	}
+	old := make(map[string]*Route)
+	for i, route := range r.conf.Routes {
+		if route.Name != "" {
+			old[route.Name] = &r.conf.Routes[i]
+		}
+	}
+
+	var routes []routeTable.Route
+	named := make(map[string]*namedRoute)
+	for i := range conf.Routes {
+		route := &conf.Routes[i]
+		// Unnamed routes start afresh on every reload
+		kept, o := r.named[route.Name], old[route.Name]
+		if kept == nil || o == nil {
+			kept = &namedRoute{}
+		}
+
+		var split *routeTable.Split
+		if len(route.Splits) > 0 {
+			split = kept.split
+			if split == nil || !route.sameSplit(o) {
+				var err error
+				if split, err = route.newSplit(); err != nil {
+					return nil, nil, err
+				}
+			}
+		}
+		var mirror *routeTable.Mirror
+		if route.Mirror != nil {
+			mirror = kept.mirror
+			if mirror == nil || !route.sameMirror(o) {
+				mirror = route.newMirror()
+			}
+		}
+
+		if route.Name != "" {
+			named[route.Name] = &namedRoute{split: split, mirror: mirror}
+		}
+		routes = append(routes, route.route(split, mirror))
+	}
+	def := ""
+	if _, ok := pools[routeTable.DefaultPool]; ok {
+		def = routeTable.DefaultPool
+	}
+
+	table, err := routeTable.NewTable(list, routes, def)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return table, named, nil
+}
+
+// The balancer's settings for conf, picking with table
+func (conf *Config) settings(table *routeTable.Table) balancer.Settings {
+	return balancer.Settings{
+		Picker:   table,
+		Hedging:  conf.Hedging.policy(),
+		Retries:  conf.Retries.policy(),
+		Timeouts: conf.Timeouts.policy(),
+	}
+}
+
+// The set of every pool, by name
+func (r *Runner) sets() map[string]*serverSet.Set {
+	sets := make(map[string]*serverSet.Set)
+	for name, p := range r.pools {
+		sets[name] = p.set
+	}
+
+	return sets
+}
+
+// The servers of every pool, to keep connections open to
+func (r *Runner) servers() []string {
+	var servers []string
+	for _, p := range r.pools {
+		servers = append(servers, p.set.Servers()...)
+	}
+
+	return servers
+}
+
+// Returns an error naming the first change that can't be applied while running
+func needsRestart(old *Config, conf *Config) error {
+	if conf.Consumers != old.Consumers {
+		return fmt.Errorf("changing Consumers needs a restart")
+	}
+	if conf.adminAddress() != old.adminAddress() {
+		return fmt.Errorf("changing AdminPort or AdminAddress needs a restart")
+	}
+	if !reflect.DeepEqual(conf.Registry, old.Registry) {
+		return fmt.Errorf("changing Registry needs a restart")
+	}
+	if conf.Connections.policy() != old.Connections.policy() {
+		return fmt.Errorf("changing Connections needs a restart")
+	}
+
+	oldListeners, listeners := old.listeners(), conf.listeners()
+	if len(listeners) != len(oldListeners) {
+		return fmt.Errorf("changing LBPort or Listeners needs a restart")
+	}
+	for i, l := range listeners {
+		o := oldListeners[i]
+		if l.Network != o.Network || l.Address != o.Address || (l.CertFile == "") != (o.CertFile == "") {
+			return fmt.Errorf("changing LBPort or Listeners needs a restart")
+		}
+	}
+
+	return nil
+}
+
+// Pulls the parsers of the services not in pulled yet, by service
+func pullParsers(registry []string, services []string, pulled map[string]bool) (map[string]*msgPeek.Parser, error) {
+	parsers := make(map[string]*msgPeek.Parser)
+	var client *lbreg.LBPullClient
+	for _, service := range services {
+		if pulled[service] {
+			continue
+		}
+		if client == nil {
+			client = lbreg.InitLBPullClient(registry)
+		}
+		parser, err := client.PullParser(service)
+		if err != nil {
+			return nil, fmt.Errorf("could not pull parser for %s: %v", service, err)
+		}
+		parsers[service] = parser
+	}
+
+	return parsers, nil
+}
+
+func (r *Runner) addParsers(parsers map[string]*msgPeek.Parser) {
+	for service, parser := range parsers {
+		r.parsers.Add(parser)
+		r.pulled[service] = true
+	}
+}
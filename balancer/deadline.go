@@ -0,0 +1,104 @@
+package balancer
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/transport"
+)
+
+type TimeoutPolicy struct {
+	// Timeout for requests that come without a grpc-timeout, by full method
+	// name, and for methods not listed; 0 means no timeout
+	Defaults map[string]time.Duration
+	Default  time.Duration
+	// Longest timeout clients may ask for, by method and for the rest;
+	// 0 means no limit
+	Max        map[string]time.Duration
+	DefaultMax time.Duration
+	// Taken off the time left before handing a request to a backend, so the
+	// balancer still has time to relay the backend's answer
+	Overhead time.Duration
+}
+
+func (tp *TimeoutPolicy) defaultTimeout(method string) time.Duration {
+	if d, ok := tp.Defaults[method]; ok {
+		return d
+	}
+	return tp.Default
+}
+
+func (tp *TimeoutPolicy) maxTimeout(method string) time.Duration {
+	if d, ok := tp.Max[method]; ok {
+		return d
+	}
+	return tp.DefaultMax
+}
+
+/*
+ * Returns the deadline of a request to method, from the client's grpc-timeout
+ * (which the transport turns into the deadline of the stream's ctx) and the
+ * configured timeouts. The zero time means the request has none. A nil policy
+ * only goes by the client's timeout.
+ */
+func (tp *TimeoutPolicy) requestDeadline(ctx context.Context, method string) time.Time {
+	deadline, ok := ctx.Deadline()
+	if tp == nil {
+		if !ok {
+			return time.Time{}
+		}
+		return deadline
+	}
+
+	now := time.Now()
+	if !ok {
+		if d := tp.defaultTimeout(method); d > 0 {
+			deadline, ok = now.Add(d), true
+		}
+	}
+	if d := tp.maxTimeout(method); d > 0 {
+		if max := now.Add(d); !ok || deadline.After(max) {
+			deadline, ok = max, true
+		}
+	}
+	if !ok {
+		return time.Time{}
+	}
+
+	return deadline
+}
+
+/*
+ * Returns the context streams to backends run under, derived from parent
+ * (usually the client stream's). Its deadline is the request's minus the
+ * balancer's overhead and is sent on to the backend as grpc-timeout, so the
+ * backend gives up before the client does.
+ */
+func (tp *TimeoutPolicy) backendContext(parent context.Context, deadline time.Time) (context.Context, context.CancelFunc) {
+	if deadline.IsZero() {
+		return context.WithCancel(parent)
+	}
+	if tp != nil {
+		deadline = deadline.Add(-tp.Overhead)
+	}
+
+	return context.WithDeadline(parent, deadline)
+}
+
+/*
+ * Ends ss with DeadlineExceeded if it is still being read from at deadline,
+ * which also unblocks the reads. The transport only enforces the client's own
+ * timeout, not the configured ones. The returned func stops the timer and
+ * reports whether it went off, in which case the status was already sent.
+ */
+func expireReads(st transport.ServerTransport, ss *transport.Stream, deadline time.Time) func() bool {
+	if deadline.IsZero() {
+		return func() bool { return false }
+	}
+	timer := time.AfterFunc(deadline.Sub(time.Now()), func() {
+		st.WriteStatus(ss, codes.DeadlineExceeded, "deadline exceeded while reading the request")
+	})
+
+	return func() bool { return !timer.Stop() }
+}
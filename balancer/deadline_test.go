@@ -0,0 +1,185 @@
+package balancer
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/transport"
+)
+
+// A client connection that records the statuses written to it
+type statusRecorder struct {
+	// Methods the tests don't call are left nil
+	transport.ServerTransport
+	mu       sync.Mutex
+	statuses []codes.Code
+}
+
+func (sr *statusRecorder) WriteStatus(s *transport.Stream, code codes.Code, desc string) error {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.statuses = append(sr.statuses, code)
+	return nil
+}
+
+func (sr *statusRecorder) written() []codes.Code {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	return append([]codes.Code(nil), sr.statuses...)
+}
+
+// Checks that deadline is d from around start, or zero if d is
+func checkDeadline(t *testing.T, name string, deadline, start time.Time, d time.Duration) {
+	if d == 0 {
+		if !deadline.IsZero() {
+			t.Errorf("%s: got a deadline in %v, want none", name, deadline.Sub(start))
+		}
+		return
+	}
+	if deadline.Before(start.Add(d)) || deadline.After(time.Now().Add(d)) {
+		t.Errorf("%s: got a deadline in %v, want %v", name, deadline.Sub(start), d)
+	}
+}
+
+func TestRequestDeadline(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeouts *TimeoutPolicy
+		// The client's grpc-timeout, 0 if it sent none
+		client time.Duration
+		want   time.Duration
+	}{
+		{name: "no timeouts"},
+		{name: "client timeout", client: 5 * time.Second, want: 5 * time.Second},
+		{
+			name:     "default",
+			timeouts: &TimeoutPolicy{Default: 2 * time.Second},
+			want:     2 * time.Second,
+		},
+		{
+			name:     "method default",
+			timeouts: &TimeoutPolicy{Defaults: map[string]time.Duration{"/m": time.Second}, Default: 2 * time.Second},
+			want:     time.Second,
+		},
+		{
+			name:     "client timeout over default",
+			timeouts: &TimeoutPolicy{Default: 2 * time.Second},
+			client:   5 * time.Second,
+			want:     5 * time.Second,
+		},
+		{
+			name:     "capped",
+			timeouts: &TimeoutPolicy{DefaultMax: 3 * time.Second},
+			client:   10 * time.Second,
+			want:     3 * time.Second,
+		},
+		{
+			name:     "method cap",
+			timeouts: &TimeoutPolicy{Max: map[string]time.Duration{"/m": time.Second}, DefaultMax: 3 * time.Second},
+			client:   10 * time.Second,
+			want:     time.Second,
+		},
+		{
+			name:     "under the cap",
+			timeouts: &TimeoutPolicy{DefaultMax: 3 * time.Second},
+			client:   time.Second,
+			want:     time.Second,
+		},
+		{
+			name:     "cap without a client timeout",
+			timeouts: &TimeoutPolicy{DefaultMax: 3 * time.Second},
+			want:     3 * time.Second,
+		},
+		{
+			name:     "other method",
+			timeouts: &TimeoutPolicy{Defaults: map[string]time.Duration{"/other": time.Second}},
+		},
+	}
+
+	for _, test := range tests {
+		start := time.Now()
+		ctx := context.Background()
+		if test.client > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, test.client)
+			defer cancel()
+		}
+		checkDeadline(t, test.name, test.timeouts.requestDeadline(ctx, "/m"), start, test.want)
+	}
+}
+
+func TestBackendContext(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeouts *TimeoutPolicy
+		deadline time.Duration
+		want     time.Duration
+	}{
+		{name: "no deadline", timeouts: &TimeoutPolicy{Overhead: time.Second}},
+		{name: "no overhead", deadline: 10 * time.Second, want: 10 * time.Second},
+		{
+			name:     "overhead",
+			timeouts: &TimeoutPolicy{Overhead: time.Second},
+			deadline: 10 * time.Second,
+			want:     9 * time.Second,
+		},
+	}
+
+	for _, test := range tests {
+		start := time.Now()
+		var deadline time.Time
+		if test.deadline > 0 {
+			deadline = start.Add(test.deadline)
+		}
+
+		parent, cancelParent := context.WithCancel(context.Background())
+		ctx, cancel := test.timeouts.backendContext(parent, deadline)
+		got, _ := ctx.Deadline()
+		if test.want == 0 {
+			checkDeadline(t, test.name, got, start, 0)
+		} else if want := start.Add(test.want); !got.Equal(want) {
+			t.Errorf("%s: got a deadline in %v, want %v", test.name, got.Sub(start), test.want)
+		}
+
+		// Backend streams end with the client's
+		cancelParent()
+		if ctx.Err() == nil {
+			t.Errorf("%s: context outlived its parent", test.name)
+		}
+		cancel()
+	}
+}
+
+func TestExpireReads(t *testing.T) {
+	ss := &transport.Stream{}
+
+	// Without a deadline nothing is ever written
+	sr := &statusRecorder{}
+	if expireReads(sr, ss, time.Time{})() {
+		t.Errorf("no deadline: reported expired")
+	}
+
+	// Reads that finish in time leave the stream alone
+	sr = &statusRecorder{}
+	expired := expireReads(sr, ss, time.Now().Add(time.Hour))
+	if expired() {
+		t.Errorf("far deadline: reported expired")
+	}
+	if got := sr.written(); len(got) != 0 {
+		t.Errorf("far deadline: wrote %v", got)
+	}
+
+	// Reads still going at the deadline end the stream
+	sr = &statusRecorder{}
+	expired = expireReads(sr, ss, time.Now().Add(10*time.Millisecond))
+	time.Sleep(50 * time.Millisecond)
+	if !expired() {
+		t.Errorf("passed deadline: not reported expired")
+	}
+	if got := sr.written(); len(got) != 1 || got[0] != codes.DeadlineExceeded {
+		t.Errorf("passed deadline: wrote %v, want DeadlineExceeded once", got)
+	}
+}
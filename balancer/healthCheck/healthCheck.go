@@ -0,0 +1,187 @@
+package healthCheck
+
+import (
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/open-lambda/load-balancer/balancer/serverSet"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type Config struct {
+	// Service name sent in each check, "" asks about the server as a whole
+	Service string
+	// Time between checks of each server
+	Interval time.Duration
+	// How long a single check may take before it counts as a failure
+	Timeout time.Duration
+	// Consecutive failures before a server is taken out of rotation
+	UnhealthyThreshold int
+	// Consecutive successes before a failed server is put back
+	HealthyThreshold int
+	// Optional, connects to servers instead of a plain TCP dial; should be
+	// the balancer's own, see balancer.WithDialer
+	Dial func(ctx context.Context, addr string) (net.Conn, error)
+}
+
+var DefaultConfig = Config{
+	Service:            "",
+	Interval:           5 * time.Second,
+	Timeout:            time.Second,
+	UnhealthyThreshold: 3,
+	HealthyThreshold:   2,
+}
+
+// Health check state of a single server
+type target struct {
+	conn      *grpc.ClientConn
+	healthy   bool
+	successes int
+	failures  int
+}
+
+/*
+ * Checker periodically calls grpc.health.v1.Health/Check on every server in a
+ * Set and marks servers down or up again once they cross the configured
+ * thresholds.
+ */
+type Checker struct {
+	conf    Config
+	set     *serverSet.Set
+	targets map[string]*target
+	done    chan struct{}
+	once    sync.Once
+}
+
+// Settings that aren't positive are taken from DefaultConfig
+func NewChecker(set *serverSet.Set, conf Config) *Checker {
+	if conf.Interval <= 0 {
+		conf.Interval = DefaultConfig.Interval
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = DefaultConfig.Timeout
+	}
+	if conf.UnhealthyThreshold <= 0 {
+		conf.UnhealthyThreshold = DefaultConfig.UnhealthyThreshold
+	}
+	if conf.HealthyThreshold <= 0 {
+		conf.HealthyThreshold = DefaultConfig.HealthyThreshold
+	}
+
+	return &Checker{
+		conf:    conf,
+		set:     set,
+		targets: make(map[string]*target),
+		done:    make(chan struct{}),
+	}
+}
+
+// Checks every server each interval until Stop is called
+func (c *Checker) Run() {
+	ticker := time.NewTicker(c.conf.Interval)
+	defer ticker.Stop()
+
+	for {
+		c.checkAll()
+		select {
+		case <-ticker.C:
+		case <-c.done:
+			for _, t := range c.targets {
+				t.conn.Close()
+			}
+			return
+		}
+	}
+}
+
+func (c *Checker) Stop() {
+	c.once.Do(func() { close(c.done) })
+}
+
+// Runs one round of checks against all servers in parallel
+func (c *Checker) checkAll() {
+	servers := c.set.Servers()
+
+	// Servers may be added and removed from the set at runtime
+	current := make(map[string]bool)
+	for _, server := range servers {
+		current[server] = true
+		if _, ok := c.targets[server]; ok {
+			continue
+		}
+		conn, err := c.dial(server)
+		if err != nil {
+			log.Printf("health check: could not dial %s: %v", server, err)
+			continue
+		}
+		c.targets[server] = &target{conn: conn, healthy: true}
+	}
+	for server, t := range c.targets {
+		if !current[server] {
+			t.conn.Close()
+			delete(c.targets, server)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for server, t := range c.targets {
+		wg.Add(1)
+		go func(server string, t *target) {
+			defer wg.Done()
+			c.check(server, t)
+		}(server, t)
+	}
+	wg.Wait()
+}
+
+// Doesn't wait for the connection, a server that is down fails its checks
+func (c *Checker) dial(server string) (*grpc.ClientConn, error) {
+	opts := []grpc.DialOption{grpc.WithInsecure()}
+	if dial := c.conf.Dial; dial != nil {
+		opts = append(opts, grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+			ctx := context.Background()
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			return dial(ctx, addr)
+		}))
+	}
+
+	return grpc.Dial(server, opts...)
+}
+
+func (c *Checker) check(server string, t *target) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.conf.Timeout)
+	defer cancel()
+
+	client := healthpb.NewHealthClient(t.conn)
+	resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: c.conf.Service})
+	if err == nil && resp.Status == healthpb.HealthCheckResponse_SERVING {
+		t.failures = 0
+		t.successes++
+		if !t.healthy && t.successes >= c.conf.HealthyThreshold {
+			log.Printf("health check: %s is healthy again", server)
+			t.healthy = true
+			c.set.SetHealthy(server, true)
+		}
+		return
+	}
+
+	t.successes = 0
+	t.failures++
+	if t.healthy && t.failures >= c.conf.UnhealthyThreshold {
+		if err != nil {
+			log.Printf("health check: %s is unhealthy: %v", server, err)
+		} else {
+			log.Printf("health check: %s is unhealthy: %v", server, resp.Status)
+		}
+		t.healthy = false
+		c.set.SetHealthy(server, false)
+	}
+}
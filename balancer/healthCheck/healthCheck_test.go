@@ -0,0 +1,124 @@
+package healthCheck
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/open-lambda/load-balancer/balancer/serverSet"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// A listener whose connections are in-memory pipes made by dial
+type pipeListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+
+	mu    sync.Mutex
+	dials []string
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{conns: make(chan net.Conn), done: make(chan struct{})}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, errors.New("listener closed")
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: "pipe", Net: "pipe"}
+}
+
+func (l *pipeListener) dial(ctx context.Context, addr string) (net.Conn, error) {
+	l.mu.Lock()
+	l.dials = append(l.dials, addr)
+	l.mu.Unlock()
+
+	client, server := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-l.done:
+		return nil, errors.New("listener closed")
+	}
+}
+
+// Runs rounds of checks until cond holds, failing the test after a while
+func checkUntil(t *testing.T, c *Checker, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		c.checkAll()
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCheckerUsesDial(t *testing.T) {
+	lis := newPipeListener()
+	hs := health.NewServer()
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, hs)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	// The address doesn't resolve, so only the pipe can reach the server
+	set := serverSet.NewSet([]string{"backend.invalid:1"})
+	c := NewChecker(set, Config{
+		Timeout:            time.Second,
+		UnhealthyThreshold: 1,
+		HealthyThreshold:   1,
+		Dial:               lis.dial,
+	})
+	defer func() {
+		for _, t := range c.targets {
+			t.conn.Close()
+		}
+	}()
+
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	checkUntil(t, c, "the server to be marked down", func() bool {
+		return len(set.Available()) == 0
+	})
+
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	checkUntil(t, c, "the server to be marked up", func() bool {
+		return len(set.Available()) == 1
+	})
+
+	lis.mu.Lock()
+	defer lis.mu.Unlock()
+	if len(lis.dials) == 0 || lis.dials[0] != "backend.invalid:1" {
+		t.Errorf("got dials %v, want backend.invalid:1", lis.dials)
+	}
+}
+
+func TestNewCheckerDefaults(t *testing.T) {
+	c := NewChecker(serverSet.NewSet(nil), Config{Interval: -time.Second})
+	if c.conf.Interval != DefaultConfig.Interval || c.conf.Timeout != DefaultConfig.Timeout {
+		t.Errorf("got interval %v and timeout %v, want the defaults", c.conf.Interval, c.conf.Timeout)
+	}
+	if c.conf.UnhealthyThreshold != DefaultConfig.UnhealthyThreshold || c.conf.HealthyThreshold != DefaultConfig.HealthyThreshold {
+		t.Errorf("got thresholds %d and %d, want the defaults", c.conf.UnhealthyThreshold, c.conf.HealthyThreshold)
+	}
+}
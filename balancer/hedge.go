@@ -0,0 +1,353 @@
+package balancer
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/open-lambda/load-balancer/balancer/serverPick"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/transport"
+)
+
+// Largest request that is buffered so it can be sent more than once
+const maxBufferedRequest = 4 * 1024 * 1024
+
+// Latencies kept per method to work out hedging percentiles
+const latencyWindowSize = 1000
+
+// Percentiles aren't trusted until a method has this many samples
+const minLatencySamples = 20
+
+type HedgePolicy struct {
+	// Full names of methods that are safe to send to several servers
+	Idempotent map[string]bool
+	// How long to wait for a response before trying the next server
+	Delay time.Duration
+	// If set (e.g. 0.95), wait for this percentile of the method's recent
+	// latencies instead of Delay once enough requests have been seen
+	Percentile float64
+	// Most servers a request is sent to, including the first
+	MaxAttempts int
+}
+
+// Recent latencies of one method, oldest overwritten first
+type latencyWindow struct {
+	samples []time.Duration
+	next    int
+}
+
+func (w *latencyWindow) add(d time.Duration) {
+	if len(w.samples) < latencyWindowSize {
+		w.samples = append(w.samples, d)
+		return
+	}
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % latencyWindowSize
+}
+
+func (w *latencyWindow) percentile(p float64) (time.Duration, bool) {
+	if len(w.samples) < minLatencySamples {
+		return 0, false
+	}
+	sorted := append([]time.Duration(nil), w.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return sorted[int(p*float64(len(sorted)-1))], true
+}
+
+// Latency windows of every method, only filled in when hedging by percentile
+type methodLatencies struct {
+	mu      sync.Mutex
+	methods map[string]*latencyWindow
+}
+
+func (ml *methodLatencies) add(method string, d time.Duration) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	if ml.methods == nil {
+		ml.methods = make(map[string]*latencyWindow)
+	}
+	w, ok := ml.methods[method]
+	if !ok {
+		w = &latencyWindow{}
+		ml.methods[method] = w
+	}
+	w.add(d)
+}
+
+func (ml *methodLatencies) percentile(method string, p float64) (time.Duration, bool) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	w, ok := ml.methods[method]
+	if !ok {
+		return 0, false
+	}
+	return w.percentile(p)
+}
+
+// Whether requests to method should be hedged
+func (hp *HedgePolicy) hedged(method string) bool {
+	return hp != nil && hp.MaxAttempts > 1 && hp.Idempotent[method]
+}
+
+// How long to wait on a server before sending the request to the next one
+func (lb *LoadBalancer) hedgeDelay(hp *HedgePolicy, method string) time.Duration {
+	if hp.Percentile > 0 {
+		if d, ok := lb.latencies.percentile(method, hp.Percentile); ok {
+			return d
+		}
+	}
+
+	return hp.Delay
+}
+
+/*
+ * Reads the rest of the request off ss after prefix. The returned bool is
+ * false if the request was too big to buffer, in which case the bytes read so
+ * far are returned to be forwarded the normal way.
+ */
+func bufferRequest(ss *transport.Stream, prefix []byte) ([]byte, bool, error) {
+	req := append([]byte(nil), prefix...)
+	buf := make([]byte, copyBufSize)
+	for {
+		n, err := ss.Read(buf)
+		req = append(req, buf[:n]...)
+		if err == io.EOF {
+			return req, true, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if len(req) > maxBufferedRequest {
+			return req, false, nil
+		}
+	}
+}
+
+// One copy of a buffered request sent to a server
+type attempt struct {
+	server string
+	// Which attempt of the request this is, counting from 0
+	index int
+	ct    transport.ClientTransport
+	cs    *transport.Stream
+	start time.Time
+	err   error
+	// The first read of the response, see sendAttempt
+	first    []byte
+	firstErr error
+}
+
+// Whether the server answered with just a status, no messages
+func (a *attempt) trailersOnly() bool {
+	return a.err == nil && len(a.first) == 0 && a.firstErr == io.EOF
+}
+
+/*
+ * Whether the attempt failed before anything worth forwarding came back: it
+ * errored, or the server answered with just an error status.
+ */
+func (a *attempt) failed() bool {
+	if a.err != nil {
+		return true
+	}
+	if a.trailersOnly() {
+		return a.cs.StatusCode() != codes.OK
+	}
+	return len(a.first) == 0 && a.firstErr != nil
+}
+
+// Status code of a failed attempt
+func (a *attempt) code() codes.Code {
+	switch {
+	case a.err != nil:
+		return errCode(a.err)
+	case a.trailersOnly():
+		return a.cs.StatusCode()
+	case a.firstErr != nil:
+		return errCode(a.firstErr)
+	}
+	return codes.OK
+}
+
+/*
+ * Sends the buffered request req to server and waits for the first bytes of
+ * the response, or for its status if it has none. The result is sent on
+ * ready either way.
+ */
+func sendAttempt(ctx context.Context, ss *transport.Stream, backends *backendPool, server string, index int, req []byte, ready chan<- *attempt) {
+	a := &attempt{server: server, index: index, start: time.Now()}
+	defer func() {
+		if a.err != nil && a.cs != nil {
+			a.ct.CloseStream(a.cs, a.err)
+		}
+		ready <- a
+	}()
+
+	a.ct, a.err = backends.get(ctx, server)
+	if _, ok := a.err.(transport.StreamError); ok {
+		// Deadline or cancellation while waiting on the connection
+		return
+	}
+	if a.err != nil {
+		a.err = transport.ConnectionError{Desc: fmt.Sprintf("could not connect to backend: %v", a.err)}
+		return
+	}
+
+	callHdr := &transport.CallHdr{
+		Host:         server,
+		Method:       ss.Method(),
+		SendCompress: ss.RecvCompress(),
+	}
+	a.cs, a.err = a.ct.NewStream(ctx, callHdr)
+	if a.err != nil {
+		return
+	}
+	if a.err = a.ct.Write(a.cs, req, &transport.Options{Last: true}); a.err != nil {
+		return
+	}
+	if _, a.err = a.cs.Header(); a.err != nil {
+		return
+	}
+
+	buf := make([]byte, copyBufSize)
+	n, err := a.cs.Read(buf)
+	a.first, a.firstErr = buf[:n], err
+}
+
+/*
+ * Sends a buffered request to the first server and, each time the hedging
+ * delay passes without a response, to the next server the picker returned.
+ * The first server to respond with something other than an error status
+ * gets to answer the client, and the others are cancelled right away. If
+ * every attempt fails, the last failure is sent to the client. Returns how
+ * the request went for the client.
+ */
+func (lb *LoadBalancer) hedgeStream(ctx context.Context, cfg *Settings, st transport.ServerTransport, ss *transport.Stream, pick *serverPick.PickResult, backends *backendPool, req []byte) streamResult {
+	servers := pick.Servers
+	if len(servers) > cfg.Hedging.MaxAttempts {
+		servers = servers[:cfg.Hedging.MaxAttempts]
+	}
+	delay := lb.hedgeDelay(cfg.Hedging, ss.Method())
+
+	// Every attempt can be cancelled on its own, by index. The picker may
+	// return a server more than once, so servers don't tell attempts apart.
+	cancels := make([]context.CancelFunc, 0, len(servers))
+	defer func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}()
+
+	ready := make(chan *attempt, len(servers))
+	launched, pending := 0, 0
+	launch := func() {
+		server := servers[launched]
+		if pick.Start != nil {
+			pick.Start(server)
+		}
+		actx, cancel := context.WithCancel(ctx)
+		cancels = append(cancels, cancel)
+		go sendAttempt(actx, ss, backends, server, launched, req, ready)
+		launched++
+		pending++
+	}
+	launch()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var winner, lastFailed *attempt
+	for winner == nil && pending > 0 {
+		select {
+		case <-timer.C:
+			if launched < len(servers) {
+				launch()
+				timer.Reset(delay)
+			}
+		case a := <-ready:
+			pending--
+			if !a.failed() {
+				winner = a
+				continue
+			}
+			// The last failure is kept to be sent on if nothing succeeds
+			if lastFailed != nil {
+				lb.discardAttempt(cfg, ss.Method(), pick, lastFailed, lastFailed.code())
+			}
+			lastFailed = a
+			// Don't wait out the delay when a server fails outright
+			if launched < len(servers) {
+				launch()
+				timer.Reset(delay)
+			}
+		}
+	}
+
+	if winner == nil {
+		res := lb.commitAttempt(cfg, st, ss, ss.Method(), pick, lastFailed, req)
+		log.Printf("all %d attempts of %s failed, last with %v", launched, ss.Method(), res.code)
+		return res
+	}
+	if lastFailed != nil {
+		lb.discardAttempt(cfg, ss.Method(), pick, lastFailed, lastFailed.code())
+	}
+
+	// Cancel the losers now so they don't keep backends busy, and finish
+	// them as they come in
+	for i, cancel := range cancels {
+		if i != winner.index {
+			cancel()
+		}
+	}
+	go func() {
+		for ; pending > 0; pending-- {
+			a := <-ready
+			code := codes.Canceled
+			if a.failed() {
+				code = a.code()
+			}
+			lb.discardAttempt(cfg, ss.Method(), pick, a, code)
+		}
+	}()
+
+	return lb.commitAttempt(cfg, st, ss, ss.Method(), pick, winner, req)
+}
+
+// Throws away an attempt that isn't answering the client
+func (lb *LoadBalancer) discardAttempt(cfg *Settings, method string, pick *serverPick.PickResult, a *attempt, code codes.Code) {
+	if a.err == nil {
+		a.ct.CloseStream(a.cs, transport.ErrConnClosing)
+	}
+	lb.finishAttempt(cfg, method, pick, a, streamResult{code: code, completed: a.trailersOnly()})
+}
+
+func (lb *LoadBalancer) finishAttempt(cfg *Settings, method string, pick *serverPick.PickResult, a *attempt, res streamResult) {
+	lb.done(cfg, method, pick, serverPick.DoneInfo{
+		Server:        a.server,
+		Code:          res.code,
+		Completed:     res.completed,
+		Latency:       time.Since(a.start),
+		BytesSent:     res.sent,
+		BytesReceived: res.received,
+	})
+}
+
+// Status code matching an error from the backend side
+func errCode(err error) codes.Code {
+	switch e := err.(type) {
+	case transport.StreamError:
+		return e.Code
+	case transport.ConnectionError:
+		return codes.Unavailable
+	}
+
+	return codes.Unknown
+}
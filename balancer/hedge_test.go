@@ -0,0 +1,221 @@
+package balancer
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+func TestLatencyWindow(t *testing.T) {
+	var w latencyWindow
+	for i := 1; i < minLatencySamples; i++ {
+		w.add(time.Duration(i) * time.Millisecond)
+	}
+	if _, ok := w.percentile(0.5); ok {
+		t.Errorf("got a percentile from %d samples", minLatencySamples-1)
+	}
+
+	for i := minLatencySamples; i <= 100; i++ {
+		w.add(time.Duration(i) * time.Millisecond)
+	}
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, time.Millisecond},
+		{0.5, 50 * time.Millisecond},
+		{0.95, 95 * time.Millisecond},
+		{1, 100 * time.Millisecond},
+	}
+	for _, test := range tests {
+		if got, ok := w.percentile(test.p); !ok || got != test.want {
+			t.Errorf("percentile %v: got %v, want %v", test.p, got, test.want)
+		}
+	}
+
+	// Only the latest samples count once the window is full
+	for i := 0; i < latencyWindowSize; i++ {
+		w.add(time.Second)
+	}
+	if got, _ := w.percentile(0); got != time.Second || len(w.samples) != latencyWindowSize {
+		t.Errorf("got fastest %v from %d samples, want 1s from %d", got, len(w.samples), latencyWindowSize)
+	}
+}
+
+func TestHedgeDelay(t *testing.T) {
+	tests := []struct {
+		name       string
+		percentile float64
+		samples    int
+		method     string
+		want       time.Duration
+	}{
+		{name: "fixed delay", samples: 100, method: "/a", want: time.Second},
+		{name: "percentile", percentile: 0.9, samples: 100, method: "/a", want: 90 * time.Millisecond},
+		{name: "too few samples", percentile: 0.9, samples: 10, method: "/a", want: time.Second},
+		{name: "other method", percentile: 0.9, samples: 100, method: "/b", want: time.Second},
+	}
+
+	for _, test := range tests {
+		lb := &LoadBalancer{}
+		for i := 1; i <= test.samples; i++ {
+			lb.latencies.add("/a", time.Duration(i)*time.Millisecond)
+		}
+		hp := &HedgePolicy{Delay: time.Second, Percentile: test.percentile}
+		if got := lb.hedgeDelay(hp, test.method); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// Hedges echoMethod over the picker's servers after delay
+func hedgeTestEnv(picker *testPicker, backends map[string]*testBackend, delay time.Duration) *testEnv {
+	e := newTestEnv(picker, backends)
+	e.lb.Reconfigure(Settings{
+		Picker: picker,
+		Hedging: &HedgePolicy{
+			Idempotent:  map[string]bool{echoMethod: true},
+			Delay:       delay,
+			MaxAttempts: len(picker.servers),
+		},
+	})
+
+	return e
+}
+
+// Answers only once the balancer gives up on the request, closing cancelled
+func hang(cancelled chan struct{}) func(ctx context.Context, req []byte) ([]byte, error) {
+	return func(ctx context.Context, req []byte) ([]byte, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	}
+}
+
+func waitClosed(t *testing.T, c chan struct{}, what string) {
+	select {
+	case <-c:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+func TestHedgeWinnerCancelsLosers(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	cancelled := make(chan struct{})
+	var mu sync.Mutex
+	var arrived time.Time
+	picker := newTestPicker("slow", "fast")
+	e := hedgeTestEnv(picker, map[string]*testBackend{
+		"slow": newTestBackend(hang(cancelled)),
+		"fast": newTestBackend(func(ctx context.Context, req []byte) ([]byte, error) {
+			mu.Lock()
+			arrived = time.Now()
+			mu.Unlock()
+			return echo("fast")(ctx, req)
+		}),
+	}, delay)
+	defer e.close()
+	cc := e.client(t)
+	defer cc.Close()
+
+	start := time.Now()
+	resp, err := call(context.Background(), cc, "hello")
+	if err != nil || resp != "fast:hello" {
+		t.Fatalf("got %q, %v, want %q", resp, err, "fast:hello")
+	}
+	// The second server only hears of the request once the first is late
+	mu.Lock()
+	if waited := arrived.Sub(start); waited < delay {
+		t.Errorf("hedged after %v, want at least %v", waited, delay)
+	}
+	mu.Unlock()
+
+	// The loser is cancelled rather than left to run
+	waitClosed(t, cancelled, "the slow server to be cancelled")
+	got := make(map[string]codes.Code)
+	for i := 0; i < 2; i++ {
+		done := picker.next(t)
+		got[done.Server] = done.Code
+	}
+	if got["fast"] != codes.OK || got["slow"] != codes.Canceled {
+		t.Errorf("got codes %v, want OK from fast and Canceled from slow", got)
+	}
+}
+
+func TestHedgeFailsOver(t *testing.T) {
+	picker := newTestPicker("bad", "good")
+	e := hedgeTestEnv(picker, map[string]*testBackend{
+		"bad": newTestBackend(func(ctx context.Context, req []byte) ([]byte, error) {
+			return nil, grpc.Errorf(codes.Unavailable, "overloaded")
+		}),
+		"good": newTestBackend(echo("good")),
+	}, time.Hour)
+	defer e.close()
+	cc := e.client(t)
+	defer cc.Close()
+
+	// A server that fails outright doesn't make the request wait out the delay
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := call(ctx, cc, "hello")
+	if err != nil || resp != "good:hello" {
+		t.Errorf("got %q, %v, want %q", resp, err, "good:hello")
+	}
+}
+
+func TestHedgeAllFail(t *testing.T) {
+	unavailable := func(ctx context.Context, req []byte) ([]byte, error) {
+		return nil, grpc.Errorf(codes.Unavailable, "overloaded")
+	}
+	picker := newTestPicker("a", "b")
+	e := hedgeTestEnv(picker, map[string]*testBackend{
+		"a": newTestBackend(unavailable),
+		"b": newTestBackend(unavailable),
+	}, time.Hour)
+	defer e.close()
+	cc := e.client(t)
+	defer cc.Close()
+
+	if _, err := call(context.Background(), cc, "hello"); grpc.Code(err) != codes.Unavailable {
+		t.Errorf("got %v, want Unavailable", err)
+	}
+	for i := 0; i < 2; i++ {
+		if done := picker.next(t); done.Code != codes.Unavailable {
+			t.Errorf("got %+v, want Unavailable", done)
+		}
+	}
+}
+
+func TestHedgeSameServerTwice(t *testing.T) {
+	cancelled := make(chan struct{})
+	var mu sync.Mutex
+	calls := 0
+	picker := newTestPicker("a", "a")
+	e := hedgeTestEnv(picker, map[string]*testBackend{
+		"a": newTestBackend(func(ctx context.Context, req []byte) ([]byte, error) {
+			mu.Lock()
+			calls++
+			first := calls == 1
+			mu.Unlock()
+			if first {
+				return hang(cancelled)(ctx, req)
+			}
+			return echo("a")(ctx, req)
+		}),
+	}, 20*time.Millisecond)
+	defer e.close()
+	cc := e.client(t)
+	defer cc.Close()
+
+	resp, err := call(context.Background(), cc, "hello")
+	if err != nil || resp != "a:hello" {
+		t.Fatalf("got %q, %v, want %q", resp, err, "a:hello")
+	}
+	// Attempts on the same server are still cancelled on their own
+	waitClosed(t, cancelled, "the first attempt to be cancelled")
+}
@@ -1,5 +1,330 @@
 package codegen
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/open-lambda/load-balancer/balancer/msgPeek"
+)
+
+var scalarTypes = map[string]bool{
+	"double": true, "float": true, "int32": true, "int64": true,
+	"uint32": true, "uint64": true, "sint32": true, "sint64": true,
+	"fixed32": true, "fixed64": true, "sfixed32": true, "sfixed64": true,
+	"bool": true, "string": true,
+}
+
+// Splits a .proto file into identifiers, numbers, strings and symbols
+func tokenize(src string) []string {
+	var tokens []string
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return tokens
+			}
+			i += end + 4
+		case unicode.IsSpace(rune(c)):
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(src) && src[j] != c {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				j = len(src) - 1
+			}
+			tokens = append(tokens, src[i:j+1])
+			i = j + 1
+		case c == '_' || c == '.' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)):
+			j := i
+			for j < len(src) && (src[j] == '_' || src[j] == '.' || unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j]))) {
+				j++
+			}
+			tokens = append(tokens, src[i:j])
+			i = j
+		default:
+			tokens = append(tokens, string(c))
+			i++
+		}
+	}
+
+	return tokens
+}
+
+type rpc struct {
+	name            string
+	input           string
+	clientStreaming bool
+	serverStreaming bool
+}
+
+// Just enough of a .proto parser to find the request fields of each rpc
+type protoParser struct {
+	tokens   []string
+	pos      int
+	pkg      string
+	messages map[string][]msgPeek.Field
+	enums    map[string]bool
+	services map[string][]rpc
+}
+
+func (p *protoParser) next() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	return t
+}
+
+func (p *protoParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *protoParser) expect(t string) error {
+	if got := p.next(); got != t {
+		return fmt.Errorf("expected %q, got %q", t, got)
+	}
+	return nil
+}
+
+// Skips to the end of the current statement or block
+func (p *protoParser) skipStatement() {
+	depth := 0
+	for {
+		switch p.next() {
+		case "":
+			return
+		case "{":
+			depth++
+		case "}":
+			depth--
+			if depth <= 0 {
+				return
+			}
+		case ";":
+			if depth == 0 {
+				return
+			}
+		}
+	}
+}
+
+func (p *protoParser) parseFile() error {
+	for p.peek() != "" {
+		switch p.peek() {
+		case "package":
+			p.next()
+			p.pkg = p.next()
+			if err := p.expect(";"); err != nil {
+				return err
+			}
+		case "message":
+			p.next()
+			if err := p.parseMessage(p.next()); err != nil {
+				return err
+			}
+		case "enum":
+			p.next()
+			p.enums[p.next()] = true
+			p.skipStatement()
+		case "service":
+			p.next()
+			if err := p.parseService(p.next()); err != nil {
+				return err
+			}
+		default:
+			// syntax, import, option
+			p.skipStatement()
+		}
+	}
+
+	return nil
+}
+
+func (p *protoParser) parseMessage(name string) error {
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+
+	fields := []msgPeek.Field{}
+	for {
+		switch t := p.peek(); t {
+		case "":
+			return fmt.Errorf("message %s is not closed", name)
+		case "}":
+			p.next()
+			p.messages[name] = fields
+			return nil
+		case "message":
+			p.next()
+			if err := p.parseMessage(name + "." + p.next()); err != nil {
+				return err
+			}
+		case "enum":
+			p.next()
+			p.enums[name+"."+p.next()] = true
+			p.skipStatement()
+		case "oneof":
+			// Fields of a oneof are fields of the message itself
+			p.next()
+			p.next()
+			if err := p.expect("{"); err != nil {
+				return err
+			}
+			for p.peek() != "}" && p.peek() != "" {
+				if f, ok := p.parseField(name); ok {
+					fields = append(fields, f)
+				}
+			}
+			p.next()
+		case "option", "reserved", "extensions", "map", ";":
+			p.skipStatement()
+		default:
+			if f, ok := p.parseField(name); ok {
+				fields = append(fields, f)
+			}
+		}
+	}
+}
+
+/*
+ * Parses "[label] type name = number [options];", false for repeated fields.
+ * Field types are resolved once the whole file has been read.
+ */
+func (p *protoParser) parseField(msg string) (msgPeek.Field, bool) {
+	start := p.pos
+	label := ""
+	if t := p.peek(); t == "repeated" || t == "optional" || t == "required" {
+		label = p.next()
+	}
+	typ, name := p.next(), p.next()
+	eq, num := p.next(), p.next()
+	p.pos = start
+	p.skipStatement()
+
+	number, err := strconv.Atoi(num)
+	if eq != "=" || err != nil || label == "repeated" {
+		return msgPeek.Field{}, false
+	}
+	if !scalarTypes[typ] {
+		// Remember where the type was used so nested enums can be found
+		typ = msg + " " + typ
+	}
+
+	return msgPeek.Field{Name: name, Number: number, Type: typ}, true
+}
+
+// Keeps the scalar and enum fields of a message, dropping nested messages
+func (p *protoParser) resolveFields(fields []msgPeek.Field) []msgPeek.Field {
+	resolved := []msgPeek.Field{}
+	for _, f := range fields {
+		if scalarTypes[f.Type] {
+			resolved = append(resolved, f)
+			continue
+		}
+
+		parts := strings.SplitN(f.Type, " ", 2)
+		msg, typ := parts[0], strings.TrimPrefix(strings.TrimPrefix(parts[1], "."), p.pkg+".")
+		if p.enums[typ] || p.enums[msg+"."+typ] {
+			f.Type = "enum"
+			resolved = append(resolved, f)
+		}
+	}
+
+	return resolved
+}
+
+func (p *protoParser) parseService(name string) error {
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+
+	for {
+		switch p.peek() {
+		case "":
+			return fmt.Errorf("service %s is not closed", name)
+		case "}":
+			p.next()
+			return nil
+		case "rpc":
+			p.next()
+			r := rpc{name: p.next()}
+			if err := p.expect("("); err != nil {
+				return err
+			}
+			if p.peek() == "stream" {
+				p.next()
+				r.clientStreaming = true
+			}
+			r.input = p.next()
+			if err := p.expect(")"); err != nil {
+				return err
+			}
+			if err := p.expect("returns"); err != nil {
+				return err
+			}
+			if err := p.expect("("); err != nil {
+				return err
+			}
+			if p.peek() == "stream" {
+				p.next()
+				r.serverStreaming = true
+			}
+			p.skipStatement()
+			p.services[name] = append(p.services[name], r)
+		default:
+			p.skipStatement()
+		}
+	}
+}
+
+/*
+ * Generates the parser the balancer uses to decode request messages of the
+ * services in proto (see msgPeek).
+ */
 func GenParser(name string, proto []byte) ([]byte, error) {
-	return []byte("This is a fake parser"), nil
+	p := &protoParser{
+		tokens:   tokenize(string(proto)),
+		messages: make(map[string][]msgPeek.Field),
+		enums:    make(map[string]bool),
+		services: make(map[string][]rpc),
+	}
+	if err := p.parseFile(); err != nil {
+		return nil, fmt.Errorf("could not parse proto for %s: %v", name, err)
+	}
+
+	parser := msgPeek.Parser{Methods: make(map[string]*msgPeek.Method)}
+	for service, rpcs := range p.services {
+		full := service
+		if p.pkg != "" {
+			full = p.pkg + "." + service
+		}
+		for _, r := range rpcs {
+			input := strings.TrimPrefix(strings.TrimPrefix(r.input, "."), p.pkg+".")
+			method := &msgPeek.Method{
+				ClientStreaming: r.clientStreaming,
+				ServerStreaming: r.serverStreaming,
+				Fields:          p.resolveFields(p.messages[input]),
+			}
+			parser.Methods[fmt.Sprintf("/%s/%s", full, r.name)] = method
+		}
+	}
+
+	return parser.Marshal()
 }
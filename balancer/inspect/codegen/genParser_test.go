@@ -0,0 +1,150 @@
+package codegen
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/open-lambda/load-balancer/balancer/msgPeek"
+)
+
+const testProto = `
+syntax = "proto3";
+
+package shop.v1;
+
+option go_package = "shop";
+
+/* Block comments and
+   line comments are ignored */
+service Orders {
+  // Unary
+  rpc Get (GetRequest) returns (Order) {}
+  rpc Watch (GetRequest) returns (stream Order);
+  rpc Upload (stream Chunk) returns (Order) { option deprecated = true; }
+  rpc Chat (stream Chunk) returns (stream Chunk) {}
+  rpc Qualified (.shop.v1.GetRequest) returns (Order) {}
+}
+
+message GetRequest {
+  string id = 1;
+  int64 version = 2 [deprecated = true];
+  Status status = 3;
+  Inner.Kind kind = 4;
+  Inner inner = 5;
+  repeated int32 tags = 6;
+  map<string, string> labels = 7;
+  oneof lookup {
+    string name = 8;
+    uint32 number = 9;
+  }
+  reserved 10, 11;
+  bytes blob = 12;
+
+  message Inner {
+    enum Kind {
+      A = 0;
+    }
+    string id = 1;
+  }
+}
+
+enum Status {
+  UNKNOWN = 0;
+}
+
+message Chunk {
+  bytes data = 1;
+  sint32 seq = 2;
+}
+
+message Order {}
+`
+
+func TestGenParser(t *testing.T) {
+	data, err := GenParser("shop", []byte(testProto))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser, err := msgPeek.Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getFields := []msgPeek.Field{
+		{Name: "id", Number: 1, Type: "string"},
+		{Name: "version", Number: 2, Type: "int64"},
+		{Name: "status", Number: 3, Type: "enum"},
+		{Name: "kind", Number: 4, Type: "enum"},
+		{Name: "name", Number: 8, Type: "string"},
+		{Name: "number", Number: 9, Type: "uint32"},
+	}
+	chunkFields := []msgPeek.Field{{Name: "seq", Number: 2, Type: "sint32"}}
+	want := map[string]*msgPeek.Method{
+		"/shop.v1.Orders/Get":       {Fields: getFields},
+		"/shop.v1.Orders/Watch":     {ServerStreaming: true, Fields: getFields},
+		"/shop.v1.Orders/Upload":    {ClientStreaming: true, Fields: chunkFields},
+		"/shop.v1.Orders/Chat":      {ClientStreaming: true, ServerStreaming: true, Fields: chunkFields},
+		"/shop.v1.Orders/Qualified": {Fields: getFields},
+	}
+
+	for name, m := range want {
+		got, ok := parser.Methods[name]
+		if !ok {
+			t.Errorf("%s: missing", name)
+			continue
+		}
+		if !reflect.DeepEqual(got, m) {
+			t.Errorf("%s: got %+v, want %+v", name, got, m)
+		}
+	}
+	if len(parser.Methods) != len(want) {
+		t.Errorf("got %d methods, want %d", len(parser.Methods), len(want))
+	}
+}
+
+func TestGenParserNoPackage(t *testing.T) {
+	proto := `service Echo { rpc Say (Msg) returns (Msg); } message Msg { string text = 1; }`
+	data, err := GenParser("echo", []byte(proto))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser, err := msgPeek.Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &msgPeek.Method{Fields: []msgPeek.Field{{Name: "text", Number: 1, Type: "string"}}}
+	if got := parser.Methods["/Echo/Say"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestGenParserErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		proto string
+	}{
+		{"unclosed message", `message Msg { string text = 1;`},
+		{"unclosed service", `service Echo { rpc Say (Msg) returns (Msg);`},
+		{"message without body", `message Msg;`},
+		{"rpc without parens", `service Echo { rpc Say Msg returns (Msg); }`},
+		{"rpc without returns", `service Echo { rpc Say (Msg) (Msg); }`},
+		{"rpc with unclosed request", `service Echo { rpc Say (Msg returns (Msg); }`},
+		{"oneof without body", `message Msg { oneof x; }`},
+	}
+
+	for _, test := range tests {
+		if _, err := GenParser("test", []byte(test.proto)); err == nil {
+			t.Errorf("%s: no error", test.name)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	src := `a.b_c = 12; // comment
+"quoted \" string" /* block */ {x}`
+	want := []string{"a.b_c", "=", "12", ";", `"quoted \" string"`, "{", "x", "}"}
+	if got := tokenize(src); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
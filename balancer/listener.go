@@ -0,0 +1,153 @@
+package balancer
+
+import (
+	"crypto/tls"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	"github.com/open-lambda/load-balancer/balancer/serverPick"
+)
+
+// Longest a client may take to finish the TLS handshake
+const handshakeTimeout = 10 * time.Second
+
+/*
+ * An address the balancer accepts client connections on. All listeners share
+ * the balancer's backends, but each may have its own TLS settings and picker.
+ */
+type Listener struct {
+	// "tcp", "tcp4", "tcp6" or "unix"
+	Network string
+	// host:port, or a socket path for "unix"
+	Address string
+	// Optional, serve TLS on this listener
+	TLS *tls.Config
+	// Optional, used instead of the balancer's picker for requests that
+	// come in on this listener
+	Picker serverPick.Picker
+	// Optional, an already open listener to accept on instead of opening
+	// Address; Network and Address are then only used in logs
+	Existing net.Listener
+}
+
+// A client connection and the listener it came in on
+type Conn struct {
+	net.Conn
+	// nil for connections pushed onto Conns by hand, which are served
+	// without TLS and with the balancer's picker
+	Listener *Listener
+}
+
+func (l *Listener) listen() (net.Listener, error) {
+	if l.Existing != nil {
+		return l.Existing, nil
+	}
+	if l.Network == "unix" {
+		// A socket left over from an earlier run would make Listen fail
+		if fi, err := os.Stat(l.Address); err == nil && fi.Mode()&os.ModeSocket != 0 && stale(l.Address) {
+			os.Remove(l.Address)
+		}
+	}
+
+	return net.Listen(l.Network, l.Address)
+}
+
+// Whether nothing accepts connections on the unix socket at path anymore
+func stale(path string) bool {
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return false
+	}
+	// A busy listener is still alive
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return false
+	}
+
+	return true
+}
+
+/*
+ * Wraps conn in TLS if the listener asks for it. gRPC needs HTTP/2 to be
+ * negotiated through ALPN, so "h2" is offered if the config doesn't. A nil
+ * listener, e.g. on a Conn pushed onto Conns by hand, is plain TCP.
+ */
+func (l *Listener) wrap(conn net.Conn) (net.Conn, error) {
+	if l == nil || l.TLS == nil {
+		return conn, nil
+	}
+
+	config := l.TLS
+	hasH2 := false
+	for _, proto := range config.NextProtos {
+		hasH2 = hasH2 || proto == "h2"
+	}
+	if !hasH2 {
+		config = config.Clone()
+		config.NextProtos = append(config.NextProtos, "h2")
+	}
+
+	// A client that never finishes the handshake would hold the
+	// connection open forever
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	tlsconn := tls.Server(conn, config)
+	if err := tlsconn.Handshake(); err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	return tlsconn, nil
+}
+
+// Picker for requests on connections from l, fallback if it doesn't set one
+func (l *Listener) picker(fallback serverPick.Picker) serverPick.Picker {
+	if l != nil && l.Picker != nil {
+		return l.Picker
+	}
+	return fallback
+}
+
+/*
+ * Accepts connections on lis and hands them to the consumers until lis fails
+ * or Shutdown is called.
+ */
+func (lb *LoadBalancer) serve(lis net.Listener, l *Listener) error {
+	done := lb.tracker.shuttingDown()
+
+	var delay time.Duration
+	for {
+		conn, err := lis.Accept()
+		select {
+		case <-done:
+			if conn != nil {
+				conn.Close()
+			}
+			return ErrShutdown
+		default:
+		}
+		if err != nil {
+			// Back off on temporary errors (e.g. out of fds) like net/http does
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay *= 2; delay > time.Second {
+					delay = time.Second
+				}
+				log.Printf("accept error on %s: %v; retrying in %v", l.Address, err, delay)
+				time.Sleep(delay)
+				continue
+			}
+			return err
+		}
+		delay = 0
+
+		select {
+		case lb.Conns <- &Conn{Conn: conn, Listener: l}:
+		case <-done:
+			conn.Close()
+			return ErrShutdown
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package balancer
+
+import (
+	"io"
+	"time"
+
+	"github.com/open-lambda/load-balancer/balancer/serverPick"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/transport"
+)
+
+// How long a copy of a request without a deadline may take
+const mirrorTimeout = 30 * time.Second
+
+/*
+ * Sends a copy of the buffered request req to the mirror's server in the
+ * background and throws the response away. The copy doesn't end with the
+ * client's request, so a slow shadow server never holds up the client. The
+ * outcome of the request itself has to be sent on the returned channel, to be
+ * compared with the copy's.
+ */
+func (lb *LoadBalancer) mirrorStream(cfg *Settings, ss *transport.Stream, info *serverPick.PickInfo, mirror *serverPick.MirrorResult, backends *backendPool, req []byte) chan<- serverPick.DoneInfo {
+	primary := make(chan serverPick.DoneInfo, 1)
+	// Lets Shutdown wait for the copy before closing the backend connections
+	backends.mirrors.Add(1)
+
+	go func() {
+		defer backends.mirrors.Done()
+
+		server := mirror.Servers[0]
+		if mirror.Start != nil {
+			mirror.Start(server)
+		}
+
+		ctx, cancel := cfg.mirrorContext(ss.Context(), info.Deadline)
+		defer cancel()
+
+		ready := make(chan *attempt, 1)
+		sendAttempt(ctx, ss, backends, server, 0, req, ready)
+		a := <-ready
+
+		res := streamResult{sent: int64(len(req))}
+		switch {
+		case a.failed():
+			res.code, res.completed = a.code(), a.trailersOnly()
+		case a.trailersOnly():
+			res.code, res.completed = codes.OK, true
+		default:
+			res.code, res.completed, res.received = discardResponse(a.cs)
+			res.received += int64(len(a.first))
+		}
+		if a.err == nil {
+			a.ct.CloseStream(a.cs, nil)
+		}
+
+		shadow := serverPick.DoneInfo{
+			Server:        server,
+			Code:          res.code,
+			Completed:     res.completed,
+			Latency:       time.Since(a.start),
+			BytesSent:     res.sent,
+			BytesReceived: res.received,
+		}
+		if mirror.Done != nil {
+			mirror.Done(shadow)
+		}
+		p := <-primary
+		if mirror.Compare != nil {
+			mirror.Compare(p, shadow)
+		}
+	}()
+
+	return primary
+}
+
+/*
+ * The context a copy of a request runs under: the metadata of the client's
+ * stream ctx and the same deadline as backendContext gives the request
+ * itself, but not cancelled along with the client's stream.
+ */
+func (cfg *Settings) mirrorContext(client context.Context, deadline time.Time) (context.Context, context.CancelFunc) {
+	ctx := context.Background()
+	if md, ok := metadata.FromContext(client); ok {
+		ctx = metadata.NewContext(ctx, md)
+	}
+	if deadline.IsZero() {
+		return context.WithTimeout(ctx, mirrorTimeout)
+	}
+
+	return cfg.Timeouts.backendContext(ctx, deadline)
+}
+
+// Reads a response to the end, returning its status and how much was read
+func discardResponse(cs *transport.Stream) (code codes.Code, completed bool, received int64) {
+	buf := make([]byte, copyBufSize)
+	for {
+		n, err := cs.Read(buf)
+		received += int64(n)
+		if err == io.EOF {
+			return cs.StatusCode(), true, received
+		}
+		if err != nil {
+			return errCode(err), false, received
+		}
+	}
+}
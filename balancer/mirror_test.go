@@ -0,0 +1,52 @@
+package balancer
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestMirrorContext(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeouts *TimeoutPolicy
+		deadline time.Duration
+		want     time.Duration
+	}{
+		{name: "no deadline", timeouts: &TimeoutPolicy{Overhead: time.Second}, want: mirrorTimeout},
+		{name: "deadline", deadline: 10 * time.Second, want: 10 * time.Second},
+		{
+			name:     "overhead",
+			timeouts: &TimeoutPolicy{Overhead: time.Second},
+			deadline: 10 * time.Second,
+			want:     9 * time.Second,
+		},
+	}
+
+	for _, test := range tests {
+		cfg := &Settings{Timeouts: test.timeouts}
+		client, cancelClient := context.WithCancel(context.Background())
+		client = metadata.NewContext(client, metadata.Pairs("user", "alice"))
+		start := time.Now()
+		var deadline time.Time
+		if test.deadline > 0 {
+			deadline = start.Add(test.deadline)
+		}
+
+		ctx, cancel := cfg.mirrorContext(client, deadline)
+		got, _ := ctx.Deadline()
+		checkDeadline(t, test.name, got, start, test.want)
+		if md, ok := metadata.FromContext(ctx); !ok || len(md["user"]) != 1 || md["user"][0] != "alice" {
+			t.Errorf("%s: got metadata %v, want the client's", test.name, md)
+		}
+
+		// The copy carries on once the client is done
+		cancelClient()
+		if ctx.Err() != nil {
+			t.Errorf("%s: cancelled along with the client", test.name)
+		}
+		cancel()
+	}
+}
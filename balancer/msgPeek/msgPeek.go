@@ -0,0 +1,180 @@
+package msgPeek
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+)
+
+/*
+ * Parsers let the balancer look inside request messages without having the
+ * service's generated Go code. codegen.GenParser turns a service's .proto into
+ * a Parser, which is stored in the registry and pulled by the balancer. Only
+ * top level scalar fields can be decoded; nested messages, bytes and repeated
+ * fields are skipped.
+ */
+
+// A top level field of a request message
+type Field struct {
+	Name   string
+	Number int
+	// Protobuf scalar type, e.g. "string" or "int64"
+	Type string
+}
+
+// Request message description of one rpc
+type Method struct {
+	// Streaming requests aren't peeked at, the client may be waiting on the
+	// server before it sends anything
+	ClientStreaming bool
+	ServerStreaming bool
+	Fields          []Field
+}
+
+// Methods by full name, e.g. /helloworld.Greeter/SayHello
+type Parser struct {
+	Methods map[string]*Method
+}
+
+var errTruncated = errors.New("truncated message")
+
+func (p *Parser) Marshal() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+func Unmarshal(data []byte) (*Parser, error) {
+	p := &Parser{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Parsers of every service the balancer knows about, safe for concurrent use
+type Table struct {
+	mu      sync.RWMutex
+	methods map[string]*Method
+}
+
+func NewTable() *Table {
+	return &Table{methods: make(map[string]*Method)}
+}
+
+// Adds the methods of p, replacing any methods with the same name
+func (t *Table) Add(p *Parser) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for name, m := range p.Methods {
+		t.methods[name] = m
+	}
+}
+
+func (t *Table) Lookup(method string) (*Method, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	m, ok := t.methods[method]
+	return m, ok
+}
+
+/*
+ * Decodes the fields of m found in msg, a serialized request message without
+ * the gRPC length prefix. Values are formatted the way strconv would.
+ */
+func (m *Method) Decode(msg []byte) (map[string]string, error) {
+	byNumber := make(map[int]Field, len(m.Fields))
+	for _, f := range m.Fields {
+		byNumber[f.Number] = f
+	}
+
+	values := make(map[string]string)
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return values, errTruncated
+		}
+		msg = msg[n:]
+		number, wire := int(key>>3), key&7
+
+		var raw uint64
+		var data []byte
+		switch wire {
+		case 0:
+			raw, n = binary.Uvarint(msg)
+			if n <= 0 {
+				return values, errTruncated
+			}
+			msg = msg[n:]
+		case 1:
+			if len(msg) < 8 {
+				return values, errTruncated
+			}
+			raw = binary.LittleEndian.Uint64(msg)
+			msg = msg[8:]
+		case 2:
+			l, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < l {
+				return values, errTruncated
+			}
+			data = msg[n : n+int(l)]
+			msg = msg[n+int(l):]
+		case 5:
+			if len(msg) < 4 {
+				return values, errTruncated
+			}
+			raw = uint64(binary.LittleEndian.Uint32(msg))
+			msg = msg[4:]
+		default:
+			// Groups are long deprecated and never show up in proto3
+			return values, errors.New("unsupported wire type " + strconv.Itoa(int(wire)))
+		}
+
+		f, ok := byNumber[number]
+		if !ok {
+			continue
+		}
+		// Last value wins, as in any protobuf decoder
+		if value, ok := formatValue(f.Type, wire, raw, data); ok {
+			values[f.Name] = value
+		}
+	}
+
+	return values, nil
+}
+
+// Formats a decoded value, false if the wire type doesn't match the field type
+func formatValue(typ string, wire uint64, raw uint64, data []byte) (string, bool) {
+	switch typ {
+	case "string":
+		return string(data), wire == 2
+	case "bool":
+		return strconv.FormatBool(raw != 0), wire == 0
+	case "int32", "enum":
+		return strconv.FormatInt(int64(int32(raw)), 10), wire == 0
+	case "int64":
+		return strconv.FormatInt(int64(raw), 10), wire == 0
+	case "uint32", "uint64":
+		return strconv.FormatUint(raw, 10), wire == 0
+	case "sint32", "sint64":
+		return strconv.FormatInt(int64(raw>>1)^-int64(raw&1), 10), wire == 0
+	case "fixed32":
+		return strconv.FormatUint(raw, 10), wire == 5
+	case "sfixed32":
+		return strconv.FormatInt(int64(int32(raw)), 10), wire == 5
+	case "fixed64":
+		return strconv.FormatUint(raw, 10), wire == 1
+	case "sfixed64":
+		return strconv.FormatInt(int64(raw), 10), wire == 1
+	case "float":
+		return strconv.FormatFloat(float64(math.Float32frombits(uint32(raw))), 'g', -1, 32), wire == 5
+	case "double":
+		return strconv.FormatFloat(math.Float64frombits(raw), 'g', -1, 64), wire == 1
+	}
+
+	return "", false
+}
@@ -0,0 +1,198 @@
+package msgPeek
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func varint(v uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return buf[:binary.PutUvarint(buf, v)]
+}
+
+func key(number int, wire uint64) []byte {
+	return varint(uint64(number)<<3 | wire)
+}
+
+func cat(parts ...[]byte) []byte {
+	var msg []byte
+	for _, part := range parts {
+		msg = append(msg, part...)
+	}
+	return msg
+}
+
+func bytesField(number int, data []byte) []byte {
+	return cat(key(number, 2), varint(uint64(len(data))), data)
+}
+
+func fixed32(v uint32) []byte {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, v)
+	return buf
+}
+
+func fixed64(v uint64) []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, v)
+	return buf
+}
+
+var testMethod = &Method{Fields: []Field{
+	{Name: "name", Number: 1, Type: "string"},
+	{Name: "count", Number: 2, Type: "int32"},
+	{Name: "id", Number: 3, Type: "int64"},
+	{Name: "delta", Number: 4, Type: "sint64"},
+	{Name: "ok", Number: 5, Type: "bool"},
+	{Name: "ratio", Number: 6, Type: "double"},
+	{Name: "weight", Number: 7, Type: "float"},
+	{Name: "hash", Number: 8, Type: "fixed32"},
+	{Name: "offset", Number: 9, Type: "sfixed64"},
+	{Name: "kind", Number: 10, Type: "enum"},
+}}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     []byte
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			msg:  nil,
+			want: map[string]string{},
+		},
+		{
+			name: "scalars",
+			msg: cat(
+				bytesField(1, []byte("alice")),
+				key(2, 0), varint(42),
+				key(3, 0), varint(1<<40),
+				key(4, 0), varint(5), // zigzag -3
+				key(5, 0), varint(1),
+				key(6, 1), fixed64(math.Float64bits(0.25)),
+				key(7, 5), fixed32(math.Float32bits(1.5)),
+				key(8, 5), fixed32(7),
+				key(9, 1), fixed64(uint64(1<<64-2)), // -2
+				key(10, 0), varint(3),
+			),
+			want: map[string]string{
+				"name": "alice", "count": "42", "id": "1099511627776", "delta": "-3",
+				"ok": "true", "ratio": "0.25", "weight": "1.5", "hash": "7",
+				"offset": "-2", "kind": "3",
+			},
+		},
+		{
+			name: "negative int32 takes ten bytes",
+			msg:  cat(key(2, 0), varint(uint64(1<<64-1))),
+			want: map[string]string{"count": "-1"},
+		},
+		{
+			name: "last value wins",
+			msg:  cat(bytesField(1, []byte("a")), bytesField(1, []byte("b"))),
+			want: map[string]string{"name": "b"},
+		},
+		{
+			name: "unknown fields are skipped",
+			msg: cat(
+				key(20, 0), varint(1),
+				key(21, 1), fixed64(1),
+				bytesField(22, []byte("xyz")),
+				key(23, 5), fixed32(1),
+				bytesField(1, []byte("bob")),
+			),
+			want: map[string]string{"name": "bob"},
+		},
+		{
+			name: "nested messages are skipped",
+			msg: cat(
+				bytesField(11, cat(bytesField(1, []byte("inner")), key(2, 0), varint(9))),
+				key(2, 0), varint(1),
+			),
+			want: map[string]string{"count": "1"},
+		},
+		{
+			// A packed repeated field is length delimited, which doesn't
+			// match the scalar type of a field with the same number
+			name: "packed fields are skipped",
+			msg:  cat(bytesField(2, cat(varint(1), varint(2), varint(3))), bytesField(1, []byte("c"))),
+			want: map[string]string{"name": "c"},
+		},
+		{
+			name:    "truncated key",
+			msg:     []byte{0x80},
+			want:    map[string]string{},
+			wantErr: true,
+		},
+		{
+			name:    "truncated varint",
+			msg:     cat(bytesField(1, []byte("d")), key(2, 0), []byte{0xff, 0xff}),
+			want:    map[string]string{"name": "d"},
+			wantErr: true,
+		},
+		{
+			name:    "varint longer than 64 bits",
+			msg:     cat(key(2, 0), []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}),
+			want:    map[string]string{},
+			wantErr: true,
+		},
+		{
+			name:    "truncated fixed64",
+			msg:     cat(key(6, 1), []byte{1, 2, 3}),
+			want:    map[string]string{},
+			wantErr: true,
+		},
+		{
+			name:    "truncated fixed32",
+			msg:     cat(key(8, 5), []byte{1}),
+			want:    map[string]string{},
+			wantErr: true,
+		},
+		{
+			name:    "length past the end",
+			msg:     cat(key(1, 2), varint(10), []byte("short")),
+			want:    map[string]string{},
+			wantErr: true,
+		},
+		{
+			name:    "length overflows int",
+			msg:     cat(key(1, 2), varint(1<<64-1), []byte("x")),
+			want:    map[string]string{},
+			wantErr: true,
+		},
+		{
+			name:    "group wire type",
+			msg:     cat(key(1, 3)),
+			want:    map[string]string{},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := testMethod.Decode(test.msg)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: got error %v, want error %v", test.name, err, test.wantErr)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	p := &Parser{Methods: map[string]*Method{"/pkg.Svc/Call": testMethod}}
+	data, err := p.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, p) {
+		t.Errorf("got %+v, want %+v", got, p)
+	}
+}
@@ -0,0 +1,43 @@
+package balancer
+
+import (
+	"net"
+
+	"golang.org/x/net/context"
+)
+
+// Connects to a backend; ctx bounds the dial, not the connection
+type DialFunc func(ctx context.Context, addr string) (net.Conn, error)
+
+// Changes how a LoadBalancer is set up, passed to Init
+type Option func(*LoadBalancer)
+
+/*
+ * Accepts clients on lis, e.g. one shared with another server or an in-memory
+ * listener in tests. Once a listener is given the balancer doesn't open
+ * Address itself; add a Listener for it if it should. Run closes lis when it
+ * returns.
+ */
+func WithListener(lis net.Listener) Option {
+	return func(lb *LoadBalancer) {
+		lb.Listeners = append(lb.Listeners, &Listener{
+			Network:  lis.Addr().Network(),
+			Address:  lis.Addr().String(),
+			Existing: lis,
+		})
+	}
+}
+
+// Shares connections to backends as policy says
+func WithPooling(policy PoolPolicy) Option {
+	return func(lb *LoadBalancer) {
+		lb.Pooling = policy
+	}
+}
+
+// Connects to backends with dial, e.g. over in-memory pipes or a proxy
+func WithDialer(dial DialFunc) Option {
+	return func(lb *LoadBalancer) {
+		lb.Dial = dial
+	}
+}
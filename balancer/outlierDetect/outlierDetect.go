@@ -0,0 +1,265 @@
+package outlierDetect
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/open-lambda/load-balancer/balancer/serverSet"
+	"google.golang.org/grpc/codes"
+)
+
+type Config struct {
+	// Failures in a row that eject a server right away, 0 disables
+	ConsecutiveErrors int
+	// Fraction of failed requests in an interval that ejects a server, 0 disables
+	ErrorRate float64
+	// Requests a server must see in an interval before ErrorRate applies
+	MinRequests int
+	// How often error rates are evaluated and ejections expire
+	Interval time.Duration
+	// Ejection time the first time a server is ejected, doubled every time after
+	BaseEjectionTime time.Duration
+	// Upper bound on the ejection time
+	MaxEjectionTime time.Duration
+	// Never eject more than this percentage of the servers at once
+	MaxEjectionPercent int
+	// Statuses returned by a backend that count as failures
+	FailureCodes []codes.Code
+}
+
+var DefaultConfig = Config{
+	ConsecutiveErrors:  5,
+	ErrorRate:          0.5,
+	MinRequests:        20,
+	Interval:           10 * time.Second,
+	BaseEjectionTime:   30 * time.Second,
+	MaxEjectionTime:    5 * time.Minute,
+	MaxEjectionPercent: 50,
+	FailureCodes: []codes.Code{
+		codes.Unknown,
+		codes.Internal,
+		codes.Unavailable,
+		codes.DataLoss,
+	},
+}
+
+// Traffic results of a single server
+type stats struct {
+	requests    int
+	failures    int
+	consecutive int
+	// Times ejected, decays by one every clean interval
+	ejections    int
+	ejectedUntil time.Time
+}
+
+/*
+ * Detector watches the result of every request the balancer forwards and
+ * ejects servers from a Set when they fail too often. Ejected servers come
+ * back after their ejection time runs out; servers that keep failing are
+ * ejected for exponentially longer.
+ */
+type Detector struct {
+	// Never held while calling into the set, which calls KeepServers with
+	// its own lock held
+	mu       sync.Mutex
+	conf     Config
+	set      *serverSet.Set
+	failures map[codes.Code]bool
+	servers  map[string]*stats
+	// Every server in the set, available or not
+	members map[string]bool
+	// Keeps ejections reaching the set in the order they were decided
+	ejectMu sync.Mutex
+	done    chan struct{}
+	once    sync.Once
+}
+
+// Durations that aren't positive are taken from DefaultConfig
+func NewDetector(set *serverSet.Set, conf Config) *Detector {
+	if conf.Interval <= 0 {
+		conf.Interval = DefaultConfig.Interval
+	}
+	if conf.BaseEjectionTime <= 0 {
+		conf.BaseEjectionTime = DefaultConfig.BaseEjectionTime
+	}
+	if conf.MaxEjectionTime <= 0 {
+		conf.MaxEjectionTime = DefaultConfig.MaxEjectionTime
+	}
+
+	d := &Detector{
+		conf:     conf,
+		set:      set,
+		failures: make(map[codes.Code]bool),
+		servers:  make(map[string]*stats),
+		members:  make(map[string]bool),
+		done:     make(chan struct{}),
+	}
+	for _, code := range conf.FailureCodes {
+		d.failures[code] = true
+	}
+	for _, server := range set.Servers() {
+		d.members[server] = true
+	}
+
+	return d
+}
+
+/*
+ * Records the status of a request forwarded to server. Servers that have
+ * left the set are ignored, e.g. a request that finished after a removal.
+ */
+func (d *Detector) Report(server string, code codes.Code) {
+	d.mu.Lock()
+	if !d.members[server] {
+		d.mu.Unlock()
+		return
+	}
+
+	st := d.stats(server)
+	st.requests++
+	if !d.failures[code] {
+		st.consecutive = 0
+		d.mu.Unlock()
+		return
+	}
+
+	st.failures++
+	st.consecutive++
+	ejected := false
+	if d.conf.ConsecutiveErrors > 0 && st.consecutive >= d.conf.ConsecutiveErrors {
+		ejected = d.eject(server, st, time.Now())
+	}
+	d.mu.Unlock()
+
+	if ejected {
+		d.ejectMu.Lock()
+		d.set.SetEjected(server, true)
+		d.ejectMu.Unlock()
+	}
+}
+
+// Ejection is tracked by the set itself, so only KeepServers matters
+func (d *Detector) SetServers(servers []string) {}
+
+// Forgets the servers that left the set, see serverSet.Pruner
+func (d *Detector) KeepServers(servers []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.members = make(map[string]bool, len(servers))
+	for _, server := range servers {
+		d.members[server] = true
+	}
+	for server := range d.servers {
+		if !d.members[server] {
+			delete(d.servers, server)
+		}
+	}
+}
+
+/*
+ * Evaluates error rates and expires ejections each interval until Stop is
+ * called. Servers are forgotten as they leave the set while it runs.
+ */
+func (d *Detector) Run() {
+	d.set.Watch(d)
+	defer d.set.Unwatch(d)
+
+	ticker := time.NewTicker(d.conf.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			d.sweep(now)
+		case <-d.done:
+			return
+		}
+	}
+}
+
+func (d *Detector) Stop() {
+	d.once.Do(func() { close(d.done) })
+}
+
+func (d *Detector) sweep(now time.Time) {
+	d.ejectMu.Lock()
+	defer d.ejectMu.Unlock()
+
+	// Whether each changed server is ejected, passed on to the set once
+	// d.mu is released
+	changed := make(map[string]bool)
+	d.mu.Lock()
+	for server, st := range d.servers {
+		if d.isEjected(st) {
+			if now.After(st.ejectedUntil) {
+				log.Printf("outlier detection: returning %s to rotation", server)
+				st.ejectedUntil = time.Time{}
+				st.consecutive = 0
+				changed[server] = false
+			}
+		} else if d.conf.ErrorRate > 0 && st.requests >= d.conf.MinRequests &&
+			float64(st.failures)/float64(st.requests) >= d.conf.ErrorRate {
+			if d.eject(server, st, now) {
+				changed[server] = true
+			}
+		} else if st.failures == 0 && st.ejections > 0 {
+			st.ejections--
+		}
+
+		st.requests = 0
+		st.failures = 0
+	}
+	d.mu.Unlock()
+
+	for server, ejected := range changed {
+		d.set.SetEjected(server, ejected)
+	}
+}
+
+/*
+ * Marks server as ejected unless too many servers are out already, must hold
+ * d.mu. The caller tells the set if it returns true.
+ */
+func (d *Detector) eject(server string, st *stats, now time.Time) bool {
+	if d.isEjected(st) {
+		return false
+	}
+
+	ejected := 0
+	for _, other := range d.servers {
+		if d.isEjected(other) {
+			ejected++
+		}
+	}
+	total := len(d.members)
+	if total == 0 || (ejected+1)*100 > total*d.conf.MaxEjectionPercent {
+		return false
+	}
+
+	duration := d.conf.BaseEjectionTime << uint(st.ejections)
+	if duration > d.conf.MaxEjectionTime || duration <= 0 {
+		duration = d.conf.MaxEjectionTime
+	}
+	st.ejections++
+	st.ejectedUntil = now.Add(duration)
+
+	log.Printf("outlier detection: ejecting %s for %v", server, duration)
+	return true
+}
+
+func (d *Detector) isEjected(st *stats) bool {
+	return !st.ejectedUntil.IsZero()
+}
+
+func (d *Detector) stats(server string) *stats {
+	st, ok := d.servers[server]
+	if !ok {
+		st = &stats{}
+		d.servers[server] = st
+	}
+
+	return st
+}
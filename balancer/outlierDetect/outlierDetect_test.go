@@ -0,0 +1,235 @@
+package outlierDetect
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/open-lambda/load-balancer/balancer/serverSet"
+	"google.golang.org/grpc/codes"
+)
+
+func newTestDetector(servers []string, conf Config) (*Detector, *serverSet.Set) {
+	if conf.FailureCodes == nil {
+		conf.FailureCodes = DefaultConfig.FailureCodes
+	}
+	if conf.MaxEjectionPercent == 0 {
+		conf.MaxEjectionPercent = 100
+	}
+	set := serverSet.NewSet(servers)
+	return NewDetector(set, conf), set
+}
+
+func report(d *Detector, server string, code codes.Code, n int) {
+	for i := 0; i < n; i++ {
+		d.Report(server, code)
+	}
+}
+
+func available(set *serverSet.Set) []string {
+	servers := set.Available()
+	sort.Strings(servers)
+	return servers
+}
+
+func TestConsecutiveErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		codes   []codes.Code
+		ejected bool
+	}{
+		{
+			name:    "enough failures",
+			codes:   []codes.Code{codes.Unavailable, codes.Internal, codes.Unavailable},
+			ejected: true,
+		},
+		{
+			name:  "too few failures",
+			codes: []codes.Code{codes.Unavailable, codes.Unavailable},
+		},
+		{
+			name:  "success in between",
+			codes: []codes.Code{codes.Unavailable, codes.Unavailable, codes.OK, codes.Unavailable},
+		},
+		{
+			// Errors the client caused say nothing about the server
+			name:  "not failure codes",
+			codes: []codes.Code{codes.NotFound, codes.InvalidArgument, codes.Canceled},
+		},
+	}
+
+	for _, test := range tests {
+		d, set := newTestDetector([]string{"a", "b"}, Config{ConsecutiveErrors: 3})
+		for _, code := range test.codes {
+			d.Report("a", code)
+		}
+
+		want := []string{"a", "b"}
+		if test.ejected {
+			want = []string{"b"}
+		}
+		if got := available(set); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got available %v, want %v", test.name, got, want)
+		}
+	}
+}
+
+func TestErrorRate(t *testing.T) {
+	tests := []struct {
+		name             string
+		requests, failed int
+		ejected          bool
+	}{
+		{name: "above the rate", requests: 10, failed: 6, ejected: true},
+		{name: "at the rate", requests: 10, failed: 5, ejected: true},
+		{name: "below the rate", requests: 10, failed: 4},
+		{name: "too few requests", requests: 9, failed: 9},
+	}
+
+	for _, test := range tests {
+		d, set := newTestDetector([]string{"a", "b"}, Config{ErrorRate: 0.5, MinRequests: 10})
+		report(d, "a", codes.Unavailable, test.failed)
+		report(d, "a", codes.OK, test.requests-test.failed)
+		// Nothing is ejected until the interval ends
+		if got := available(set); len(got) != 2 {
+			t.Fatalf("%s: got available %v before a sweep, want [a b]", test.name, got)
+		}
+
+		d.sweep(time.Now())
+		want := []string{"a", "b"}
+		if test.ejected {
+			want = []string{"b"}
+		}
+		if got := available(set); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got available %v, want %v", test.name, got, want)
+		}
+	}
+}
+
+func TestMaxEjectionPercent(t *testing.T) {
+	servers := []string{"a", "b", "c", "d"}
+	d, set := newTestDetector(servers, Config{ConsecutiveErrors: 1, MaxEjectionPercent: 50})
+
+	// Every server fails, only half of them go
+	for _, server := range servers {
+		d.Report(server, codes.Unavailable)
+	}
+	if got := available(set); !reflect.DeepEqual(got, []string{"c", "d"}) {
+		t.Errorf("got available %v, want [c d]", got)
+	}
+
+	// A server that comes back makes room for another
+	d.sweep(time.Now().Add(DefaultConfig.BaseEjectionTime + time.Second))
+	d.Report("c", codes.Unavailable)
+	if got := available(set); !reflect.DeepEqual(got, []string{"a", "b", "d"}) {
+		t.Errorf("got available %v after a sweep, want [a b d]", got)
+	}
+}
+
+func TestEjectionExpires(t *testing.T) {
+	base := time.Minute
+	conf := Config{ConsecutiveErrors: 1, BaseEjectionTime: base, MaxEjectionTime: 3 * base}
+	d, set := newTestDetector([]string{"a", "b"}, conf)
+	now := time.Now()
+
+	// The ejection time doubles every time until it reaches the maximum
+	for _, want := range []time.Duration{base, 2 * base, 3 * base, 3 * base} {
+		d.Report("a", codes.Unavailable)
+		if got := available(set); !reflect.DeepEqual(got, []string{"b"}) {
+			t.Fatalf("got available %v, want [b]", got)
+		}
+
+		d.mu.Lock()
+		until := d.servers["a"].ejectedUntil
+		d.mu.Unlock()
+		if got := until.Sub(now); got < want || got > want+time.Second {
+			t.Errorf("ejected for %v, want %v", got, want)
+		}
+
+		d.sweep(until.Add(-time.Second))
+		if got := available(set); !reflect.DeepEqual(got, []string{"b"}) {
+			t.Errorf("got available %v before the ejection ran out, want [b]", got)
+		}
+		d.sweep(until.Add(time.Second))
+		if got := available(set); !reflect.DeepEqual(got, []string{"a", "b"}) {
+			t.Errorf("got available %v after the ejection ran out, want [a b]", got)
+		}
+		now = time.Now()
+	}
+
+	// Clean intervals bring the ejection time back down
+	d.sweep(now)
+	d.sweep(now)
+	d.sweep(now)
+	d.Report("a", codes.Unavailable)
+	d.mu.Lock()
+	until := d.servers["a"].ejectedUntil
+	d.mu.Unlock()
+	if got := until.Sub(now); got > 2*base+time.Second {
+		t.Errorf("ejected for %v after clean intervals, want at most %v", got, 2*base)
+	}
+}
+
+func TestForgetsRemovedServers(t *testing.T) {
+	d, set := newTestDetector([]string{"a", "b"}, Config{ConsecutiveErrors: 3})
+	set.Watch(d)
+	defer set.Unwatch(d)
+
+	report(d, "a", codes.Unavailable, 2)
+	report(d, "b", codes.OK, 1)
+	set.Remove("a")
+	d.mu.Lock()
+	_, kept := d.servers["a"]
+	d.mu.Unlock()
+	if kept {
+		t.Errorf("stats kept for a removed server")
+	}
+
+	// Requests that finish after the removal are not recorded
+	report(d, "a", codes.Unavailable, 1)
+	d.mu.Lock()
+	n := len(d.servers)
+	d.mu.Unlock()
+	if n != 1 {
+		t.Errorf("got stats for %d servers, want 1", n)
+	}
+
+	// A server that comes back starts over
+	set.Add("a")
+	report(d, "a", codes.Unavailable, 1)
+	if got := available(set); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("got available %v, want [a b]", got)
+	}
+	report(d, "a", codes.Unavailable, 2)
+	if got := available(set); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Errorf("got available %v, want [b]", got)
+	}
+}
+
+func TestRunStops(t *testing.T) {
+	d, set := newTestDetector([]string{"a"}, Config{Interval: time.Millisecond})
+	done := make(chan struct{})
+	go func() {
+		d.Run()
+		close(done)
+	}()
+
+	d.Stop()
+	d.Stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run still going after Stop")
+	}
+
+	// A stopped detector no longer follows the set
+	set.Remove("a")
+	set.Add("b")
+	d.mu.Lock()
+	_, watched := d.members["b"]
+	d.mu.Unlock()
+	if watched {
+		t.Errorf("stopped detector still told about set changes")
+	}
+}
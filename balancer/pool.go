@@ -0,0 +1,420 @@
+package balancer
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/transport"
+)
+
+// Streams per backend connection if PoolPolicy.MaxStreams isn't set
+const defaultMaxStreams = 100
+
+// Idle time before a backend connection is closed if PoolPolicy.IdleTimeout isn't set
+const defaultIdleTimeout = 5 * time.Minute
+
+// How often the pool closes idle and old connections and tops up warm ones
+const reapInterval = 5 * time.Second
+
+// Longest a new backend connection may take to set up
+const dialTimeout = 20 * time.Second
+
+var errPoolClosed = errors.New("balancer: backend connections closed")
+
+/*
+ * How the balancer shares connections to backends. Client streams to the same
+ * backend are multiplexed onto a few long-lived HTTP/2 connections, whichever
+ * client connection they came in on, so most requests skip the dial and
+ * handshake.
+ */
+type PoolPolicy struct {
+	// Most streams on one connection before another one is opened,
+	// defaultMaxStreams if 0
+	MaxStreams int
+	// Connections older than this take no new streams and are closed once
+	// their last stream is done; 0 means no limit
+	MaxAge time.Duration
+	// Connections without streams for this long are closed,
+	// defaultIdleTimeout if 0
+	IdleTimeout time.Duration
+	// Connections kept open to each backend given to WarmBackends, even
+	// while idle
+	Warm int
+}
+
+func (pp *PoolPolicy) maxStreams() int {
+	if pp.MaxStreams > 0 {
+		return pp.MaxStreams
+	}
+	return defaultMaxStreams
+}
+
+func (pp *PoolPolicy) idleTimeout() time.Duration {
+	if pp.IdleTimeout > 0 {
+		return pp.IdleTimeout
+	}
+	return defaultIdleTimeout
+}
+
+/*
+ * A pooled connection to a backend. Every get from the pool reserves one
+ * stream on it, which is given back when the stream is closed or fails to
+ * open.
+ */
+type pooledConn struct {
+	transport.ClientTransport
+	pool    *backendPool
+	created time.Time
+
+	// Guarded by pool.mu
+	streams   int
+	open      map[*transport.Stream]bool
+	idleSince time.Time
+}
+
+func (pc *pooledConn) NewStream(ctx context.Context, callHdr *transport.CallHdr) (*transport.Stream, error) {
+	s, err := pc.ClientTransport.NewStream(ctx, callHdr)
+
+	pc.pool.mu.Lock()
+	defer pc.pool.mu.Unlock()
+	if err != nil {
+		pc.release()
+		return nil, err
+	}
+	pc.open[s] = true
+
+	return s, nil
+}
+
+// Safe to call more than once for a stream, only the first call counts
+func (pc *pooledConn) CloseStream(s *transport.Stream, err error) {
+	pc.ClientTransport.CloseStream(s, err)
+
+	pc.pool.mu.Lock()
+	defer pc.pool.mu.Unlock()
+	if pc.open[s] {
+		delete(pc.open, s)
+		pc.release()
+	}
+}
+
+// Gives back a stream, must hold pool.mu
+func (pc *pooledConn) release() {
+	pc.streams--
+	if pc.streams == 0 {
+		pc.idleSince = time.Now()
+	}
+}
+
+// Whether the connection can take no new streams
+func (pc *pooledConn) broken() bool {
+	return pc.dead() || pc.goingAway()
+}
+
+func (pc *pooledConn) dead() bool {
+	select {
+	case <-pc.Error():
+		return true
+	default:
+		return false
+	}
+}
+
+// Whether the backend sent GOAWAY; streams already open may still finish
+func (pc *pooledConn) goingAway() bool {
+	select {
+	case <-pc.GoAway():
+		return true
+	default:
+		return false
+	}
+}
+
+func (pc *pooledConn) expired(policy *PoolPolicy, now time.Time) bool {
+	return policy.MaxAge > 0 && now.Sub(pc.created) > policy.MaxAge
+}
+
+// A dial in progress, which streams to the same backend wait for
+type dialCall struct {
+	done chan struct{}
+	err  error
+}
+
+type backendConnList struct {
+	conns   []*pooledConn
+	dialing *dialCall
+}
+
+/*
+ * The connections to every backend, shared by all client connections. The
+ * zero value isn't usable, see newBackendPool.
+ */
+type backendPool struct {
+	policy PoolPolicy
+	dial   DialFunc
+
+	mu       sync.Mutex
+	backends map[string]*backendConnList
+	warm     map[string]bool
+	closed   bool
+	done     chan struct{}
+
+	// Copies of requests still being sent, see mirrorStream
+	mirrors sync.WaitGroup
+}
+
+// Starts closing idle and old connections right away
+func newBackendPool(dial DialFunc, policy PoolPolicy) *backendPool {
+	bp := &backendPool{
+		policy:   policy,
+		dial:     dial,
+		backends: make(map[string]*backendConnList),
+		warm:     make(map[string]bool),
+		done:     make(chan struct{}),
+	}
+	go bp.run()
+
+	return bp
+}
+
+func (bp *backendPool) backend(addr string) *backendConnList {
+	b, ok := bp.backends[addr]
+	if !ok {
+		b = &backendConnList{}
+		bp.backends[addr] = b
+	}
+	return b
+}
+
+/*
+ * Returns a connection to addr with room for one more stream, dialing a new
+ * one if every connection is full, old or broken. The stream is reserved, so
+ * it has to be opened with NewStream right after. Gives up with ctx's error
+ * if ctx is done before the connection is.
+ */
+func (bp *backendPool) get(ctx context.Context, addr string) (transport.ClientTransport, error) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	for {
+		if bp.closed {
+			return nil, errPoolClosed
+		}
+
+		b := bp.backend(addr)
+		// The oldest connections are filled first so the newer ones can idle out
+		now := time.Now()
+		for _, pc := range b.conns {
+			if pc.streams < bp.policy.maxStreams() && !pc.expired(&bp.policy, now) && !pc.broken() {
+				pc.streams++
+				return pc, nil
+			}
+		}
+
+		// The dial outlives ctx, so other streams can still use it
+		d := b.dialing
+		if d == nil {
+			d = bp.startDial(addr, b, false)
+		}
+		bp.mu.Unlock()
+		select {
+		case <-d.done:
+			bp.mu.Lock()
+		case <-ctx.Done():
+			bp.mu.Lock()
+			return nil, transport.ContextErr(ctx.Err())
+		}
+		if d.err != nil {
+			return nil, d.err
+		}
+	}
+}
+
+/*
+ * Opens one more connection to addr in the background, must hold bp.mu.
+ * Only one dial per backend runs at a time, see backendConnList.dialing.
+ */
+func (bp *backendPool) startDial(addr string, b *backendConnList, warm bool) *dialCall {
+	d := &dialCall{done: make(chan struct{})}
+	b.dialing = d
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+		ct, err := transport.NewClientTransport(ctx, addr, transport.ConnectOptions{Dialer: bp.dial})
+		cancel()
+
+		bp.mu.Lock()
+		defer bp.mu.Unlock()
+
+		b.dialing = nil
+		if err == nil && bp.closed {
+			ct.Close()
+			err = errPoolClosed
+		}
+		d.err = err
+		close(d.done)
+
+		if err != nil {
+			if warm && err != errPoolClosed {
+				// Dialed again on the next round or the first request
+				log.Printf("could not warm connection to %s: %v", addr, err)
+			}
+			return
+		}
+		now := time.Now()
+		b.conns = append(b.conns, &pooledConn{
+			ClientTransport: ct,
+			pool:            bp,
+			created:         now,
+			open:            make(map[*transport.Stream]bool),
+			idleSince:       now,
+		})
+		if warm {
+			bp.warmLocked(addr)
+		}
+	}()
+
+	return d
+}
+
+/*
+ * Sets the backends to keep PoolPolicy.Warm connections open to, replacing
+ * the previous ones. The connections are opened in the background.
+ */
+func (bp *backendPool) warmBackends(servers []string) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	bp.warm = make(map[string]bool)
+	for _, server := range servers {
+		bp.warm[server] = true
+	}
+	bp.topUpLocked()
+}
+
+// Starts dials to the warm backends that have fewer than PoolPolicy.Warm connections
+func (bp *backendPool) topUp() {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	bp.topUpLocked()
+}
+
+func (bp *backendPool) topUpLocked() {
+	for addr := range bp.warm {
+		bp.warmLocked(addr)
+	}
+}
+
+// Starts a dial to addr if it needs another warm connection, must hold bp.mu
+func (bp *backendPool) warmLocked(addr string) {
+	if bp.closed || bp.policy.Warm <= 0 || !bp.warm[addr] {
+		return
+	}
+	b := bp.backend(addr)
+	if b.dialing != nil {
+		return
+	}
+
+	now := time.Now()
+	usable := 0
+	for _, pc := range b.conns {
+		if !pc.expired(&bp.policy, now) && !pc.broken() {
+			usable++
+		}
+	}
+	// Each finished dial starts the next one until there are enough
+	if usable < bp.policy.Warm {
+		bp.startDial(addr, b, true)
+	}
+}
+
+// Closes broken, old and idle connections, keeping warm ones
+func (bp *backendPool) reap() {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	now := time.Now()
+	for addr, b := range bp.backends {
+		keep := 0
+		if bp.warm[addr] {
+			keep = bp.policy.Warm
+		}
+
+		var live []*pooledConn
+		for _, pc := range b.conns {
+			switch {
+			case pc.dead():
+				// Streams still on it fail on their own
+				pc.Close()
+			case (pc.expired(&bp.policy, now) || pc.goingAway()) && pc.streams == 0:
+				pc.Close()
+			default:
+				live = append(live, pc)
+			}
+		}
+
+		// Idle connections beyond the warm ones go, newest first
+		for i := len(live) - 1; i >= 0 && len(live) > keep; i-- {
+			pc := live[i]
+			if pc.streams == 0 && now.Sub(pc.idleSince) > bp.policy.idleTimeout() {
+				pc.Close()
+				live = append(live[:i], live[i+1:]...)
+			}
+		}
+
+		b.conns = live
+		if len(live) == 0 && b.dialing == nil && !bp.warm[addr] {
+			delete(bp.backends, addr)
+		}
+	}
+}
+
+func (bp *backendPool) run() {
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			bp.reap()
+			bp.topUp()
+		case <-bp.done:
+			return
+		}
+	}
+}
+
+/*
+ * Waits for the copies of requests in flight until ctx expires, then closes
+ * every connection. Streams still open on them fail.
+ */
+func (bp *backendPool) close(ctx context.Context) {
+	mirrored := make(chan struct{})
+	go func() {
+		bp.mirrors.Wait()
+		close(mirrored)
+	}()
+	select {
+	case <-mirrored:
+	case <-ctx.Done():
+	}
+
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	if bp.closed {
+		return
+	}
+	bp.closed = true
+	close(bp.done)
+	for addr, b := range bp.backends {
+		for _, pc := range b.conns {
+			pc.Close()
+		}
+		delete(bp.backends, addr)
+	}
+}
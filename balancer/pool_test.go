@@ -0,0 +1,288 @@
+package balancer
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/transport"
+)
+
+// A backend connection that never touches the network
+type fakeTransport struct {
+	// Methods the pool doesn't call are left nil
+	transport.ClientTransport
+	err       chan struct{}
+	goAway    chan struct{}
+	streamErr error
+	closed    bool
+}
+
+func newFakeTransport() *fakeTransport {
+	return &fakeTransport{err: make(chan struct{}), goAway: make(chan struct{})}
+}
+
+func (ft *fakeTransport) NewStream(ctx context.Context, callHdr *transport.CallHdr) (*transport.Stream, error) {
+	if ft.streamErr != nil {
+		return nil, ft.streamErr
+	}
+	return &transport.Stream{}, nil
+}
+
+func (ft *fakeTransport) CloseStream(s *transport.Stream, err error) {}
+func (ft *fakeTransport) Error() <-chan struct{}                     { return ft.err }
+func (ft *fakeTransport) GoAway() <-chan struct{}                    { return ft.goAway }
+
+func (ft *fakeTransport) Close() error {
+	ft.closed = true
+	return nil
+}
+
+func failDial(ctx context.Context, addr string) (net.Conn, error) {
+	return nil, errors.New("dial refused")
+}
+
+// Adds a connection to addr as if it had been dialed at created
+func addConn(bp *backendPool, addr string, created time.Time) (*pooledConn, *fakeTransport) {
+	ft := newFakeTransport()
+	pc := &pooledConn{
+		ClientTransport: ft,
+		pool:            bp,
+		created:         created,
+		open:            make(map[*transport.Stream]bool),
+		idleSince:       created,
+	}
+
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	b := bp.backend(addr)
+	b.conns = append(b.conns, pc)
+
+	return pc, ft
+}
+
+func streams(bp *backendPool, pc *pooledConn) int {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	return pc.streams
+}
+
+func TestPoolReservation(t *testing.T) {
+	bp := newBackendPool(failDial, PoolPolicy{MaxStreams: 2})
+	defer bp.close(context.Background())
+	ctx := context.Background()
+	now := time.Now()
+	older, _ := addConn(bp, "a", now.Add(-time.Minute))
+	newer, _ := addConn(bp, "a", now)
+
+	// The oldest connection is filled first
+	want := []*pooledConn{older, older, newer, newer}
+	for i, w := range want {
+		ct, err := bp.get(ctx, "a")
+		if err != nil {
+			t.Fatalf("get %d: %v", i, err)
+		}
+		if ct != w {
+			t.Errorf("get %d: got the wrong connection", i)
+		}
+	}
+	if _, err := bp.get(ctx, "a"); err == nil {
+		t.Errorf("full pool with a failing dial: no error")
+	}
+
+	// Closing a stream gives its reservation back, once
+	s, err := older.NewStream(ctx, &transport.CallHdr{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	older.CloseStream(s, nil)
+	older.CloseStream(s, nil)
+	if n := streams(bp, older); n != 1 {
+		t.Errorf("got %d streams after closing one twice, want 1", n)
+	}
+
+	// So does a stream that fails to open
+	newer.ClientTransport.(*fakeTransport).streamErr = errors.New("refused")
+	if _, err := newer.NewStream(ctx, &transport.CallHdr{}); err == nil {
+		t.Fatal("NewStream: no error")
+	}
+	if n := streams(bp, newer); n != 1 {
+		t.Errorf("got %d streams after a failed open, want 1", n)
+	}
+
+	if ct, err := bp.get(ctx, "a"); err != nil || ct != older {
+		t.Errorf("got %v, want the freed stream on the oldest connection", err)
+	}
+}
+
+func TestPoolSkipsUnusable(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(pc *pooledConn, ft *fakeTransport)
+	}{
+		{"dead", func(pc *pooledConn, ft *fakeTransport) { close(ft.err) }},
+		{"going away", func(pc *pooledConn, ft *fakeTransport) { close(ft.goAway) }},
+		{"too old", func(pc *pooledConn, ft *fakeTransport) { pc.created = time.Now().Add(-2 * time.Hour) }},
+		{"full", func(pc *pooledConn, ft *fakeTransport) { pc.streams = 1 }},
+	}
+
+	for _, test := range tests {
+		bp := newBackendPool(failDial, PoolPolicy{MaxStreams: 1, MaxAge: time.Hour})
+		bad, ft := addConn(bp, "a", time.Now())
+		test.setup(bad, ft)
+		good, _ := addConn(bp, "a", time.Now())
+
+		ct, err := bp.get(context.Background(), "a")
+		bp.close(context.Background())
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if ct != good {
+			t.Errorf("%s: got the unusable connection", test.name)
+		}
+	}
+}
+
+func TestPoolDial(t *testing.T) {
+	var mu sync.Mutex
+	dials := 0
+	release := make(chan struct{})
+	dial := func(ctx context.Context, addr string) (net.Conn, error) {
+		mu.Lock()
+		dials++
+		mu.Unlock()
+		<-release
+		return nil, errors.New("dial refused")
+	}
+	bp := newBackendPool(dial, PoolPolicy{})
+	defer bp.close(context.Background())
+
+	// A request that gives up doesn't wait for the dial
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := bp.get(ctx, "a"); err == nil {
+		t.Errorf("cancelled get: no error")
+	}
+
+	// Requests arriving while a dial runs wait for it rather than dialing again
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := bp.get(context.Background(), "a")
+			errs <- err
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err == nil {
+			t.Errorf("get with a failing dial: no error")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if dials != 1 {
+		t.Errorf("got %d dials, want 1", dials)
+	}
+}
+
+func TestPoolReap(t *testing.T) {
+	policy := PoolPolicy{MaxAge: time.Hour, IdleTimeout: time.Minute, Warm: 1}
+	idle := -2 * time.Minute
+
+	tests := []struct {
+		name string
+		// Streams open on the connection
+		streams int
+		// How long ago the connection was made and went idle
+		age, idleFor time.Duration
+		goAway, dead bool
+		warm         bool
+		closed       bool
+	}{
+		{name: "in use", streams: 1, idleFor: idle},
+		{name: "idle", idleFor: idle, closed: true},
+		{name: "recently idle", idleFor: -time.Second},
+		{name: "idle but warm", idleFor: idle, warm: true},
+		{name: "too old", age: -2 * time.Hour, closed: true},
+		{name: "too old and in use", age: -2 * time.Hour, streams: 1},
+		{name: "too old and warm", age: -2 * time.Hour, warm: true, closed: true},
+		{name: "going away", goAway: true, closed: true},
+		{name: "going away and in use", goAway: true, streams: 1},
+		{name: "dead and in use", dead: true, streams: 1, closed: true},
+	}
+
+	for _, test := range tests {
+		bp := newBackendPool(failDial, policy)
+		now := time.Now()
+		pc, ft := addConn(bp, "a", now.Add(test.age))
+		pc.streams = test.streams
+		pc.idleSince = now.Add(test.idleFor)
+		if test.goAway {
+			close(ft.goAway)
+		}
+		if test.dead {
+			close(ft.err)
+		}
+		if test.warm {
+			bp.mu.Lock()
+			bp.warm["a"] = true
+			bp.mu.Unlock()
+		}
+
+		bp.reap()
+		if ft.closed != test.closed {
+			t.Errorf("%s: got closed %v, want %v", test.name, ft.closed, test.closed)
+		}
+		bp.mu.Lock()
+		_, kept := bp.backends["a"]
+		bp.mu.Unlock()
+		bp.close(context.Background())
+		if want := !test.closed || test.warm; kept != want {
+			t.Errorf("%s: got backend kept %v, want %v", test.name, kept, want)
+		}
+	}
+}
+
+func TestPoolReapKeepsWarm(t *testing.T) {
+	bp := newBackendPool(failDial, PoolPolicy{IdleTimeout: time.Minute, Warm: 2})
+	defer bp.close(context.Background())
+	bp.mu.Lock()
+	bp.warm["a"] = true
+	bp.mu.Unlock()
+
+	// Of three idle connections the newest goes, the two oldest stay warm
+	then := time.Now().Add(-time.Hour)
+	var fakes []*fakeTransport
+	for i := 0; i < 3; i++ {
+		_, ft := addConn(bp, "a", then.Add(time.Duration(i)*time.Second))
+		fakes = append(fakes, ft)
+	}
+
+	bp.reap()
+	for i, want := range []bool{false, false, true} {
+		if fakes[i].closed != want {
+			t.Errorf("connection %d: got closed %v, want %v", i, fakes[i].closed, want)
+		}
+	}
+}
+
+func TestPoolClose(t *testing.T) {
+	bp := newBackendPool(failDial, PoolPolicy{})
+	_, ft := addConn(bp, "a", time.Now())
+
+	bp.close(context.Background())
+	if !ft.closed {
+		t.Errorf("connection left open")
+	}
+	if _, err := bp.get(context.Background(), "a"); err != errPoolClosed {
+		t.Errorf("got error %v, want errPoolClosed", err)
+	}
+	// Closing twice is harmless
+	bp.close(context.Background())
+}
@@ -0,0 +1,192 @@
+package balancer
+
+import (
+	"encoding/binary"
+	"io"
+	"sync/atomic"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/transport"
+)
+
+// Size of the chunks copied between the client and backend streams
+const copyBufSize = 32 * 1024
+
+// Largest first message that is buffered to be decoded, larger ones are
+// forwarded without a look inside
+const maxPeekSize = 64 * 1024
+
+// Outcome of a proxied stream
+type streamResult struct {
+	// Status code sent to the client
+	code codes.Code
+	// Whether the backend ended the stream with its own status
+	completed bool
+	// Message bytes sent to and received from the backend
+	sent     int64
+	received int64
+}
+
+/*
+ * Proxies one client stream onto a new stream on the backend transport ct.
+ * Messages are copied as raw gRPC frames, so the balancer never needs to know
+ * the service's message types. prefix holds request bytes already read off
+ * ss, which are sent before the rest of the stream.
+ */
+func proxyStream(ctx context.Context, st transport.ServerTransport, ss *transport.Stream, ct transport.ClientTransport, addr string, prefix []byte) streamResult {
+	// ctx carries the client's metadata and the backend's deadline,
+	// NewStream sends both on to the backend
+	callHdr := &transport.CallHdr{
+		Host:         addr,
+		Method:       ss.Method(),
+		SendCompress: ss.RecvCompress(),
+	}
+	cs, err := ct.NewStream(ctx, callHdr)
+	if err != nil {
+		return streamResult{code: writeStreamErr(st, ss, err)}
+	}
+	defer ct.CloseStream(cs, nil)
+
+	var sent int64
+	go forwardRequest(ss, ct, cs, prefix, &sent)
+	res := forwardResponse(st, ss, cs, nil)
+	// The request side may still be going if the backend answered early
+	res.sent = atomic.LoadInt64(&sent)
+
+	return res
+}
+
+// Copies the request messages from the client to the backend, counting bytes in sent
+func forwardRequest(ss *transport.Stream, ct transport.ClientTransport, cs *transport.Stream, prefix []byte, sent *int64) {
+	if len(prefix) > 0 {
+		if err := ct.Write(cs, prefix, &transport.Options{}); err != nil {
+			return
+		}
+		atomic.AddInt64(sent, int64(len(prefix)))
+	}
+
+	buf := make([]byte, copyBufSize)
+	for {
+		n, err := ss.Read(buf)
+		if n > 0 {
+			if werr := ct.Write(cs, buf[:n], &transport.Options{}); werr != nil {
+				return
+			}
+			atomic.AddInt64(sent, int64(n))
+		}
+		if err == io.EOF {
+			// Client half-closed, do the same towards the backend
+			ct.Write(cs, nil, &transport.Options{Last: true})
+			return
+		}
+		if err != nil {
+			ct.CloseStream(cs, err)
+			return
+		}
+	}
+}
+
+/*
+ * Copies the response headers, messages and status from the backend to the
+ * client. first holds response bytes already read off cs, if any.
+ */
+func forwardResponse(st transport.ServerTransport, ss *transport.Stream, cs *transport.Stream, first []byte) streamResult {
+	header, err := cs.Header()
+	if err != nil {
+		return streamResult{code: writeStreamErr(st, ss, err)}
+	}
+
+	ss.SetSendCompress(cs.RecvCompress())
+	if len(header) > 0 {
+		if err := st.WriteHeader(ss, header); err != nil {
+			// Client is gone
+			return streamResult{code: codes.Canceled}
+		}
+	}
+
+	var received int64
+	if len(first) > 0 {
+		if err := st.Write(ss, first, &transport.Options{}); err != nil {
+			return streamResult{code: codes.Canceled}
+		}
+		received += int64(len(first))
+	}
+
+	buf := make([]byte, copyBufSize)
+	for {
+		n, err := cs.Read(buf)
+		if n > 0 {
+			if werr := st.Write(ss, buf[:n], &transport.Options{}); werr != nil {
+				return streamResult{code: codes.Canceled, received: received}
+			}
+			received += int64(n)
+		}
+		if err == io.EOF {
+			ss.SetTrailer(cs.Trailer())
+			st.WriteStatus(ss, cs.StatusCode(), cs.StatusDesc())
+			return streamResult{code: cs.StatusCode(), completed: true, received: received}
+		}
+		if err != nil {
+			return streamResult{code: writeStreamErr(st, ss, err), received: received}
+		}
+	}
+}
+
+/*
+ * Reads the first request message off ss. Returns everything that was read,
+ * which has to reach the backend ahead of the rest of the stream, and the
+ * serialized message if it was read whole and isn't compressed.
+ */
+func peekMessage(ss *transport.Stream) (prefix []byte, msg []byte, err error) {
+	// gRPC length prefix: compressed flag and 4 byte big endian length
+	hdr := make([]byte, 5)
+	n, err := io.ReadFull(ss, hdr)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		// Let the backend make sense of it
+		return hdr[:n], nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	length := binary.BigEndian.Uint32(hdr[1:])
+	if length > maxPeekSize {
+		return hdr, nil, nil
+	}
+
+	buf := make([]byte, 5+int(length))
+	copy(buf, hdr)
+	n, err = io.ReadFull(ss, buf[5:])
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return buf[:5+n], nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if hdr[0] != 0 {
+		return buf, nil, nil
+	}
+
+	return buf, buf[5:], nil
+}
+
+/*
+ * Ends the client stream with the status matching an error from the backend
+ * side and returns the code that was sent.
+ */
+func writeStreamErr(st transport.ServerTransport, ss *transport.Stream, err error) codes.Code {
+	var code codes.Code
+	var desc string
+	switch e := err.(type) {
+	case transport.StreamError:
+		code, desc = e.Code, e.Desc
+	case transport.ConnectionError:
+		code, desc = codes.Unavailable, e.Desc
+	default:
+		code, desc = codes.Unknown, err.Error()
+	}
+	st.WriteStatus(ss, code, desc)
+
+	return code
+}
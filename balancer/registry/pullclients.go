@@ -1,6 +1,9 @@
 package lbreg
 
-import r "github.com/open-lambda/code-registry/registry"
+import (
+	r "github.com/open-lambda/code-registry/registry"
+	"github.com/open-lambda/load-balancer/balancer/msgPeek"
+)
 
 func InitLBPullClient(cluster []string) *LBPullClient {
 	c := LBPullClient{
@@ -20,6 +23,13 @@ func (c *LBPullClient) Pull(name string) LBFiles {
 	return ret
 }
 
+// Pulls and decodes the parser the balancer uses to look inside requests
+func (c *LBPullClient) PullParser(name string) (*msgPeek.Parser, error) {
+	files := c.Pull(name)
+
+	return msgPeek.Unmarshal(files.Parser)
+}
+
 func InitServerPullClient(cluster []string) *ServerPullClient {
 	c := ServerPullClient{
 		Client: r.InitPullClient(cluster, DATABASE, SERVER),
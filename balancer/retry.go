@@ -0,0 +1,196 @@
+package balancer
+
+import (
+	"log"
+	"sync"
+
+	"github.com/open-lambda/load-balancer/balancer/serverPick"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/transport"
+)
+
+// Most retries the budget can save up while traffic is quiet
+const retryBudgetCap = 10
+
+type RetryPolicy struct {
+	// Unary methods that may be retried, by full name, and the most
+	// attempts each request to them gets, including the first
+	Methods map[string]int
+	// Statuses besides UNAVAILABLE that are worth another try
+	RetryableCodes []codes.Code
+	// Retries may make up at most this fraction of requests, e.g. 0.2
+	BudgetRatio float64
+}
+
+/*
+ * Keeps retries a bounded fraction of requests so a struggling backend pool
+ * isn't buried under a retry storm. Every request adds BudgetRatio tokens and
+ * every retry takes one.
+ */
+type retryBudget struct {
+	mu     sync.Mutex
+	tokens float64
+}
+
+func (rb *retryBudget) deposit(ratio float64) {
+	rb.mu.Lock()
+	rb.tokens += ratio
+	if rb.tokens > retryBudgetCap {
+		rb.tokens = retryBudgetCap
+	}
+	rb.mu.Unlock()
+}
+
+func (rb *retryBudget) withdraw() bool {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	if rb.tokens < 1 {
+		return false
+	}
+	rb.tokens--
+	return true
+}
+
+// Whether requests to method should be retried
+func (rp *RetryPolicy) retried(method string) bool {
+	return rp != nil && rp.Methods[method] > 1
+}
+
+func (rp *RetryPolicy) retryableCode(code codes.Code) bool {
+	if code == codes.Unavailable {
+		return true
+	}
+	for _, c := range rp.RetryableCodes {
+		if c == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Whether an error from an attempt that sent nothing back is worth retrying
+func (rp *RetryPolicy) retryableErr(err error) bool {
+	switch e := err.(type) {
+	case transport.ConnectionError:
+		// Covers refused dials and connections reset under the stream
+		return true
+	case transport.StreamError:
+		return rp.retryableCode(e.Code)
+	}
+
+	return false
+}
+
+/*
+ * Returns the server for the next attempt, preferring servers that haven't
+ * been tried. Once the first pick's servers run out the picker is asked again.
+ */
+func (lb *LoadBalancer) nextServer(info *serverPick.PickInfo, picker serverPick.Picker, pick *serverPick.PickResult, tried map[string]bool) (string, *serverPick.PickResult) {
+	for _, server := range pick.Servers {
+		if !tried[server] {
+			return server, pick
+		}
+	}
+
+	repick, err := picker.Pick(info)
+	if err != nil || len(repick.Servers) == 0 {
+		return "", nil
+	}
+	for _, server := range repick.Servers {
+		if !tried[server] {
+			return server, repick
+		}
+	}
+
+	// Every server has had a go, try the picker's favourite again
+	return repick.Servers[0], repick
+}
+
+/*
+ * Sends a buffered unary request to one server after another until one
+ * answers with something that isn't worth retrying, the method's attempts
+ * run out or the retry budget says no. Attempts are only retried while
+ * nothing has been sent back to the client, so retries are invisible to it.
+ * Returns how the request went for the client.
+ */
+func (lb *LoadBalancer) retryStream(ctx context.Context, cfg *Settings, st transport.ServerTransport, ss *transport.Stream, info *serverPick.PickInfo, picker serverPick.Picker, pick *serverPick.PickResult, backends *backendPool, req []byte) streamResult {
+	maxAttempts := cfg.Retries.Methods[info.Method]
+	tried := make(map[string]bool)
+	server := pick.Servers[0]
+
+	for {
+		tried[server] = true
+		if pick.Start != nil {
+			pick.Start(server)
+		}
+
+		ready := make(chan *attempt, 1)
+		actx, cancel := context.WithCancel(ctx)
+		sendAttempt(actx, ss, backends, server, info.Attempt, req, ready)
+		a := <-ready
+
+		// Check for a trailers-only response before committing to it
+		code := a.code()
+		retry := false
+		switch {
+		case a.err != nil:
+			retry = cfg.Retries.retryableErr(a.err)
+		case a.trailersOnly():
+			retry = cfg.Retries.retryableCode(code)
+		case len(a.first) == 0 && a.firstErr != nil:
+			retry = cfg.Retries.retryableErr(a.firstErr)
+		}
+
+		if !retry || info.Attempt+1 >= maxAttempts || ctx.Err() != nil || !lb.retryBudget.withdraw() {
+			res := lb.commitAttempt(cfg, st, ss, info.Method, pick, a, req)
+			cancel()
+			return res
+		}
+
+		if a.err == nil {
+			a.ct.CloseStream(a.cs, nil)
+		}
+		cancel()
+		lb.finishAttempt(cfg, info.Method, pick, a, streamResult{code: code})
+
+		info.Attempt++
+		var next *serverPick.PickResult
+		if server, next = lb.nextServer(info, picker, pick, tried); next == nil {
+			st.WriteStatus(ss, code, "no server left to retry on")
+			return streamResult{code: code}
+		}
+		log.Printf("retrying %s on %s (attempt %d)", info.Method, server, info.Attempt+1)
+		pick = next
+	}
+}
+
+// Forwards the response of the attempt that gets to answer the client
+func (lb *LoadBalancer) commitAttempt(cfg *Settings, st transport.ServerTransport, ss *transport.Stream, method string, pick *serverPick.PickResult, a *attempt, req []byte) streamResult {
+	var res streamResult
+	switch {
+	case a.err != nil:
+		res.code = writeStreamErr(st, ss, a.err)
+	case a.trailersOnly():
+		if header, _ := a.cs.Header(); len(header) > 0 {
+			st.WriteHeader(ss, header)
+		}
+		ss.SetTrailer(a.cs.Trailer())
+		st.WriteStatus(ss, a.cs.StatusCode(), a.cs.StatusDesc())
+		res = streamResult{code: a.cs.StatusCode(), completed: true}
+	case len(a.first) == 0 && a.firstErr != nil:
+		res.code = writeStreamErr(st, ss, a.firstErr)
+	default:
+		res = forwardResponse(st, ss, a.cs, a.first)
+	}
+	res.sent = int64(len(req))
+
+	if a.err == nil {
+		a.ct.CloseStream(a.cs, nil)
+	}
+	lb.finishAttempt(cfg, method, pick, a, res)
+
+	return res
+}
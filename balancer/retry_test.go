@@ -0,0 +1,148 @@
+package balancer
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/open-lambda/load-balancer/balancer/serverPick"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/transport"
+)
+
+func TestRetryBudget(t *testing.T) {
+	tests := []struct {
+		name     string
+		ratio    float64
+		deposits int
+		// Withdrawals that succeed before the budget runs dry
+		retries int
+	}{
+		{name: "empty", ratio: 0.25, deposits: 0, retries: 0},
+		{name: "less than one token", ratio: 0.25, deposits: 3, retries: 0},
+		{name: "one token", ratio: 0.25, deposits: 4, retries: 1},
+		{name: "token and a half", ratio: 0.5, deposits: 3, retries: 1},
+		{name: "one retry per request", ratio: 1, deposits: 5, retries: 5},
+		{name: "capped", ratio: 1, deposits: 3 * retryBudgetCap, retries: retryBudgetCap},
+		{name: "no retries", ratio: 0, deposits: 100, retries: 0},
+	}
+
+	for _, test := range tests {
+		var rb retryBudget
+		for i := 0; i < test.deposits; i++ {
+			rb.deposit(test.ratio)
+		}
+		retries := 0
+		for rb.withdraw() {
+			retries++
+		}
+		if retries != test.retries {
+			t.Errorf("%s: got %d retries, want %d", test.name, retries, test.retries)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	rp := &RetryPolicy{
+		RetryableCodes: []codes.Code{codes.ResourceExhausted, codes.Aborted},
+	}
+
+	codeTests := []struct {
+		code codes.Code
+		want bool
+	}{
+		{codes.Unavailable, true},
+		{codes.ResourceExhausted, true},
+		{codes.Aborted, true},
+		{codes.OK, false},
+		{codes.Internal, false},
+		{codes.DeadlineExceeded, false},
+		{codes.Canceled, false},
+		{codes.NotFound, false},
+	}
+	for _, test := range codeTests {
+		if got := rp.retryableCode(test.code); got != test.want {
+			t.Errorf("retryableCode(%v): got %v, want %v", test.code, got, test.want)
+		}
+	}
+
+	errTests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"refused dial", transport.ConnectionError{Desc: "connection refused"}, true},
+		{"reset connection", transport.ErrConnClosing, true},
+		{"unavailable stream", transport.StreamError{Code: codes.Unavailable}, true},
+		{"listed code", transport.StreamError{Code: codes.Aborted}, true},
+		{"client cancelled", transport.StreamError{Code: codes.Canceled}, false},
+		{"deadline", transport.StreamError{Code: codes.DeadlineExceeded}, false},
+		{"other error", errors.New("boom"), false},
+	}
+	for _, test := range errTests {
+		if got := rp.retryableErr(test.err); got != test.want {
+			t.Errorf("retryableErr(%s): got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestNextServer(t *testing.T) {
+	lb := &LoadBalancer{}
+	picker := newTestPicker("a", "b", "c")
+	info := &serverPick.PickInfo{Method: echoMethod}
+
+	// Untried servers of the first pick come first, then the picker is
+	// asked again and its favourite tried once more
+	pick := &serverPick.PickResult{Servers: []string{"a", "b"}}
+	tried := map[string]bool{"a": true}
+	var got []string
+	for i := 0; i < 4; i++ {
+		server, next := lb.nextServer(info, picker, pick, tried)
+		if next == nil {
+			t.Fatalf("no server for attempt %d", i+2)
+		}
+		got = append(got, server)
+		tried[server] = true
+		pick = next
+	}
+	if want := []string{"b", "c", "a", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got servers %v, want %v", got, want)
+	}
+
+	picker.servers = nil
+	if server, next := lb.nextServer(info, picker, pick, tried); next != nil {
+		t.Errorf("got %s with no servers left, want none", server)
+	}
+}
+
+func TestRetriesUnavailable(t *testing.T) {
+	picker := newTestPicker("bad", "good")
+	e := newTestEnv(picker, map[string]*testBackend{
+		"bad": newTestBackend(func(ctx context.Context, req []byte) ([]byte, error) {
+			return nil, grpc.Errorf(codes.Unavailable, "overloaded")
+		}),
+		"good": newTestBackend(echo("good")),
+	})
+	defer e.close()
+	e.lb.Reconfigure(Settings{
+		Picker: picker,
+		Retries: &RetryPolicy{
+			Methods:     map[string]int{echoMethod: 2},
+			BudgetRatio: 1,
+		},
+	})
+	cc := e.client(t)
+	defer cc.Close()
+
+	resp, err := call(context.Background(), cc, "hello")
+	if err != nil || resp != "good:hello" {
+		t.Errorf("got %q, %v, want %q", resp, err, "good:hello")
+	}
+	for _, want := range []string{"bad", "good"} {
+		if done := picker.next(t); done.Server != want {
+			t.Errorf("got a request to %s, want %s", done.Server, want)
+		}
+	}
+}
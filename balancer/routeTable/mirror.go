@@ -0,0 +1,65 @@
+package routeTable
+
+import (
+	"sync"
+	"time"
+
+	"github.com/open-lambda/load-balancer/balancer/serverPick"
+	"google.golang.org/grpc/codes"
+)
+
+/*
+ * Mirror copies a fraction of a route's requests to a shadow pool, e.g. to
+ * try a new version on real traffic. The shadow's responses are thrown away,
+ * only their status and latency are kept to compare with the primary's.
+ */
+type Mirror struct {
+	Pool string
+	// Fraction of the route's requests that are copied, e.g. 0.1
+	Fraction float64
+
+	mu    sync.Mutex
+	stats MirrorStats
+}
+
+type MirrorStats struct {
+	// Requests answered by both the primary and the shadow pool
+	Compared int64
+	// Of those, how many got a different status from the shadow pool
+	Mismatched int64
+	// Status codes of the shadow pool's answers
+	Codes map[codes.Code]int64
+	// Summed over the compared requests
+	PrimaryLatency time.Duration
+	ShadowLatency  time.Duration
+}
+
+// Returns the stats since the mirror was set up
+func (m *Mirror) Stats() MirrorStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := m.stats
+	stats.Codes = make(map[codes.Code]int64)
+	for code, n := range m.stats.Codes {
+		stats.Codes[code] = n
+	}
+
+	return stats
+}
+
+func (m *Mirror) compare(primary serverPick.DoneInfo, shadow serverPick.DoneInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stats.Codes == nil {
+		m.stats.Codes = make(map[codes.Code]int64)
+	}
+	m.stats.Compared++
+	if primary.Code != shadow.Code {
+		m.stats.Mismatched++
+	}
+	m.stats.Codes[shadow.Code]++
+	m.stats.PrimaryLatency += primary.Latency
+	m.stats.ShadowLatency += shadow.Latency
+}
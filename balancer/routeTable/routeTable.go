@@ -0,0 +1,348 @@
+package routeTable
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+
+	"github.com/open-lambda/load-balancer/balancer/outlierDetect"
+	"github.com/open-lambda/load-balancer/balancer/serverPick"
+)
+
+// Name given to the pool that takes requests no route matches
+const DefaultPool = "default"
+
+type MatchKind int
+
+const (
+	// The whole value must equal Value
+	MatchExact MatchKind = iota
+	// The value must start with Value, e.g. "/helloworld.Greeter/"
+	MatchPrefix
+	// Value is a regular expression the value must match
+	MatchRegex
+	// Only for metadata, the key must be there whatever its values
+	MatchPresent
+	// Only for metadata, the key must not be there
+	MatchAbsent
+)
+
+type Match struct {
+	Kind  MatchKind
+	Value string
+	re    *regexp.Regexp
+}
+
+func (m *Match) compile() error {
+	switch m.Kind {
+	case MatchExact, MatchPrefix, MatchPresent, MatchAbsent:
+		return nil
+	case MatchRegex:
+		re, err := regexp.Compile(m.Value)
+		if err != nil {
+			return err
+		}
+		m.re = re
+		return nil
+	}
+
+	return fmt.Errorf("unknown match kind %d", m.Kind)
+}
+
+func (m *Match) matches(s string) bool {
+	switch m.Kind {
+	case MatchExact:
+		return s == m.Value
+	case MatchPrefix:
+		return strings.HasPrefix(s, m.Value)
+	case MatchRegex:
+		return m.re.MatchString(s)
+	}
+
+	return false
+}
+
+// A condition on one metadata key
+type HeaderMatch struct {
+	// Lower case, like the keys of PickInfo.Metadata
+	Name string
+	// Matched against each value of the key, any of them may match
+	Match
+}
+
+func (h *HeaderMatch) matches(md map[string][]string) bool {
+	values, ok := md[h.Name]
+	switch h.Kind {
+	case MatchPresent:
+		return ok
+	case MatchAbsent:
+		return !ok
+	}
+	for _, value := range values {
+		if h.Match.matches(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// A request has to match every condition of a route to take it
+type Route struct {
+	// Optional, lets the route's split and mirror be found through the Table
+	Name string
+	// Full method names the route applies to, every method if nil
+	Method *Match
+	// The :authority of the request, any if nil
+	Authority *Match
+	// Conditions on the request metadata
+	Headers []HeaderMatch
+	// Pool that requests matching the route go to, unless Split is set
+	Pool string
+	// Optional, divides the route's requests between several pools
+	Split *Split
+	// Optional, copies some of the route's requests to a shadow pool
+	Mirror *Mirror
+}
+
+// Returns a copy of r with its regexes compiled
+func (r Route) compile() (Route, error) {
+	var err error
+	if r.Method, err = compileMatch(r.Method); err != nil {
+		return r, fmt.Errorf("method: %v", err)
+	}
+	if r.Authority, err = compileMatch(r.Authority); err != nil {
+		return r, fmt.Errorf("authority: %v", err)
+	}
+
+	headers := make([]HeaderMatch, len(r.Headers))
+	for i, h := range r.Headers {
+		if err := h.compile(); err != nil {
+			return r, fmt.Errorf("metadata %s: %v", h.Name, err)
+		}
+		headers[i] = h
+	}
+	r.Headers = headers
+
+	return r, nil
+}
+
+// Compiles a copy of m so the caller's routes are left alone
+func compileMatch(m *Match) (*Match, error) {
+	if m == nil {
+		return nil, nil
+	}
+	if m.Kind == MatchPresent || m.Kind == MatchAbsent {
+		return nil, fmt.Errorf("present and absent only apply to metadata")
+	}
+	c := *m
+	if err := c.compile(); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+func (r *Route) matches(info *serverPick.PickInfo) bool {
+	if r.Method != nil && !r.Method.matches(info.Method) {
+		return false
+	}
+	if r.Authority != nil && !r.Authority.matches(info.Authority) {
+		return false
+	}
+	for i := range r.Headers {
+		if !r.Headers[i].matches(info.Metadata) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// A named group of backends with a picker of its own
+type Pool struct {
+	Name   string
+	Picker serverPick.Picker
+	// Optional, told the outcome of every request sent to the pool
+	Outliers *outlierDetect.Detector
+}
+
+/*
+ * Table sends each request to the pool of the first route that matches it,
+ * or to the default pool if none does. It is a Picker itself, so it can be
+ * used wherever a single picker can. A Table never changes; build a new one
+ * and hand it to the balancer to change routes.
+ */
+type Table struct {
+	routes []Route
+	pools  map[string]*Pool
+	def    *Pool
+}
+
+/*
+ * Returns a table that tries routes in order. defaultPool may be empty, in
+ * which case requests matching no route fail with ErrNoRoute.
+ */
+func NewTable(pools []*Pool, routes []Route, defaultPool string) (*Table, error) {
+	t := &Table{pools: make(map[string]*Pool)}
+	for _, pool := range pools {
+		if _, ok := t.pools[pool.Name]; ok {
+			return nil, fmt.Errorf("pool %s is defined twice", pool.Name)
+		}
+		t.pools[pool.Name] = pool
+	}
+
+	for i, route := range routes {
+		if err := t.checkPools(&route); err != nil {
+			return nil, fmt.Errorf("route %d: %v", i, err)
+		}
+		route, err := route.compile()
+		if err != nil {
+			return nil, fmt.Errorf("route %d: %v", i, err)
+		}
+		t.routes = append(t.routes, route)
+	}
+
+	if defaultPool != "" {
+		def, ok := t.pools[defaultPool]
+		if !ok {
+			return nil, fmt.Errorf("unknown default pool %s", defaultPool)
+		}
+		t.def = def
+	}
+
+	return t, nil
+}
+
+// Makes sure every pool route sends requests to exists
+func (t *Table) checkPools(route *Route) error {
+	if route.Mirror != nil {
+		if _, ok := t.pools[route.Mirror.Pool]; !ok {
+			return fmt.Errorf("unknown mirror pool %s", route.Mirror.Pool)
+		}
+		if route.Mirror.Fraction < 0 || route.Mirror.Fraction > 1 {
+			return fmt.Errorf("mirror fraction %v is not between 0 and 1", route.Mirror.Fraction)
+		}
+	}
+	if route.Split == nil {
+		if _, ok := t.pools[route.Pool]; !ok {
+			return fmt.Errorf("unknown pool %s", route.Pool)
+		}
+		return nil
+	}
+	for _, pw := range route.Split.Weights() {
+		if _, ok := t.pools[pw.Pool]; !ok {
+			return fmt.Errorf("unknown pool %s in split", pw.Pool)
+		}
+	}
+
+	return nil
+}
+
+// Returns the split of the route called name, if it has one
+func (t *Table) Split(name string) (*Split, bool) {
+	for _, route := range t.routes {
+		if route.Name == name && route.Split != nil {
+			return route.Split, true
+		}
+	}
+
+	return nil, false
+}
+
+// Returns the mirror of the route called name, if it has one
+func (t *Table) Mirror(name string) (*Mirror, bool) {
+	for _, route := range t.routes {
+		if route.Name == name && route.Mirror != nil {
+			return route.Mirror, true
+		}
+	}
+
+	return nil, false
+}
+
+// Returns the pool a request goes to
+func (t *Table) Route(info *serverPick.PickInfo) (*Pool, error) {
+	_, pool, err := t.match(info)
+	return pool, err
+}
+
+// Returns the first route matching a request, nil for the default pool, and its pool
+func (t *Table) match(info *serverPick.PickInfo) (*Route, *Pool, error) {
+	for i := range t.routes {
+		route := &t.routes[i]
+		if !route.matches(info) {
+			continue
+		}
+		if route.Split != nil {
+			return route, t.pools[route.Split.choose(info)], nil
+		}
+		return route, t.pools[route.Pool], nil
+	}
+	if t.def == nil {
+		return nil, nil, serverPick.ErrNoRoute
+	}
+
+	return nil, t.def, nil
+}
+
+func (t *Table) Pick(info *serverPick.PickInfo) (*serverPick.PickResult, error) {
+	route, pool, err := t.match(info)
+	if err != nil {
+		return nil, err
+	}
+	res, err := pool.pick(info)
+	if err != nil {
+		return nil, err
+	}
+
+	if m := route.mirror(); m != nil && rand.Float64() < m.Fraction {
+		// A shadow pool without servers just means no copy is sent
+		shadow, err := t.pools[m.Pool].pick(info)
+		switch {
+		case err != nil:
+		case len(shadow.Servers) == 0:
+			if shadow.Cancel != nil {
+				shadow.Cancel()
+			}
+		default:
+			res.Mirror = &serverPick.MirrorResult{
+				PickResult: *shadow,
+				Compare:    m.compare,
+			}
+		}
+	}
+
+	return res, nil
+}
+
+func (r *Route) mirror() *Mirror {
+	if r == nil {
+		return nil
+	}
+	return r.Mirror
+}
+
+// Picks from the pool's picker, reporting outcomes to its outlier detection
+func (p *Pool) pick(info *serverPick.PickInfo) (*serverPick.PickResult, error) {
+	res, err := p.Picker.Pick(info)
+	if err != nil || p.Outliers == nil {
+		return res, err
+	}
+
+	done := res.Done
+	res.Done = func(info serverPick.DoneInfo) {
+		p.Outliers.Report(info.Server, info.Code)
+		if done != nil {
+			done(info)
+		}
+	}
+
+	return res, nil
+}
+
+// Every pool keeps track of its own servers, so there is nothing to do here
+func (t *Table) SetServers(servers []string) {
+	return
+}
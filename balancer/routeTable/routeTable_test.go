@@ -0,0 +1,212 @@
+package routeTable
+
+import (
+	"testing"
+
+	"github.com/open-lambda/load-balancer/balancer/serverPick"
+)
+
+// Picker that always picks one server named after its pool
+type poolPicker string
+
+func (p poolPicker) Pick(info *serverPick.PickInfo) (*serverPick.PickResult, error) {
+	return &serverPick.PickResult{Servers: []string{string(p)}}, nil
+}
+
+func (p poolPicker) SetServers(servers []string) {}
+
+func testPools(names ...string) []*Pool {
+	pools := make([]*Pool, len(names))
+	for i, name := range names {
+		pools[i] = &Pool{Name: name, Picker: poolPicker(name)}
+	}
+	return pools
+}
+
+func TestRoute(t *testing.T) {
+	routes := []Route{
+		{
+			Method: &Match{Kind: MatchExact, Value: "/shop.Orders/Get"},
+			Pool:   "exact",
+		},
+		{
+			Method:    &Match{Kind: MatchPrefix, Value: "/shop.Orders/"},
+			Authority: &Match{Kind: MatchExact, Value: "orders.internal"},
+			Pool:      "internal",
+		},
+		{
+			Method: &Match{Kind: MatchPrefix, Value: "/shop.Orders/"},
+			Headers: []HeaderMatch{
+				{Name: "x-version", Match: Match{Kind: MatchRegex, Value: `^v2(\.\d+)?$`}},
+			},
+			Pool: "v2",
+		},
+		{
+			Headers: []HeaderMatch{
+				{Name: "x-debug", Match: Match{Kind: MatchPresent}},
+				{Name: "x-trace", Match: Match{Kind: MatchAbsent}},
+			},
+			Pool: "debug",
+		},
+		{
+			Authority: &Match{Kind: MatchRegex, Value: `^[a-z]+\.eu\.`},
+			Pool:      "eu",
+		},
+	}
+	table, err := NewTable(testPools("exact", "internal", "v2", "debug", "eu", "default"), routes, DefaultPool)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		info serverPick.PickInfo
+		want string
+	}{
+		{
+			name: "exact method",
+			info: serverPick.PickInfo{Method: "/shop.Orders/Get", Authority: "orders.internal"},
+			want: "exact",
+		},
+		{
+			name: "method prefix and authority",
+			info: serverPick.PickInfo{Method: "/shop.Orders/List", Authority: "orders.internal"},
+			want: "internal",
+		},
+		{
+			name: "wrong authority falls through",
+			info: serverPick.PickInfo{Method: "/shop.Orders/List", Authority: "orders.example.com"},
+			want: "default",
+		},
+		{
+			name: "header regex",
+			info: serverPick.PickInfo{
+				Method:   "/shop.Orders/List",
+				Metadata: map[string][]string{"x-version": {"v2.1"}},
+			},
+			want: "v2",
+		},
+		{
+			name: "any header value may match",
+			info: serverPick.PickInfo{
+				Method:   "/shop.Orders/List",
+				Metadata: map[string][]string{"x-version": {"v1", "v2"}},
+			},
+			want: "v2",
+		},
+		{
+			name: "header regex is anchored",
+			info: serverPick.PickInfo{
+				Method:   "/shop.Orders/List",
+				Metadata: map[string][]string{"x-version": {"v20"}},
+			},
+			want: "default",
+		},
+		{
+			name: "present and absent",
+			info: serverPick.PickInfo{
+				Method:   "/shop.Users/Get",
+				Metadata: map[string][]string{"x-debug": {""}},
+			},
+			want: "debug",
+		},
+		{
+			name: "absent header is there",
+			info: serverPick.PickInfo{
+				Method:   "/shop.Users/Get",
+				Metadata: map[string][]string{"x-debug": {"1"}, "x-trace": {"1"}},
+			},
+			want: "default",
+		},
+		{
+			name: "authority regex",
+			info: serverPick.PickInfo{Method: "/shop.Users/Get", Authority: "users.eu.example.com"},
+			want: "eu",
+		},
+		{
+			name: "no route matches",
+			info: serverPick.PickInfo{Method: "/shop.Users/Get", Authority: "users.us.example.com"},
+			want: "default",
+		},
+	}
+
+	for _, test := range tests {
+		pool, err := table.Route(&test.info)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if pool.Name != test.want {
+			t.Errorf("%s: got pool %s, want %s", test.name, pool.Name, test.want)
+		}
+	}
+}
+
+func TestRouteNoDefault(t *testing.T) {
+	routes := []Route{{Method: &Match{Kind: MatchPrefix, Value: "/shop."}, Pool: "shop"}}
+	table, err := NewTable(testPools("shop"), routes, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := table.Route(&serverPick.PickInfo{Method: "/other.Svc/Call"}); err != serverPick.ErrNoRoute {
+		t.Errorf("got error %v, want ErrNoRoute", err)
+	}
+	res, err := table.Pick(&serverPick.PickInfo{Method: "/shop.Orders/Get"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Servers) != 1 || res.Servers[0] != "shop" {
+		t.Errorf("got servers %v, want [shop]", res.Servers)
+	}
+}
+
+func TestNewTableErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		pools  []*Pool
+		routes []Route
+		def    string
+	}{
+		{
+			name:  "pool defined twice",
+			pools: testPools("a", "a"),
+		},
+		{
+			name:   "unknown pool",
+			pools:  testPools("a"),
+			routes: []Route{{Pool: "b"}},
+		},
+		{
+			name:  "unknown default pool",
+			pools: testPools("a"),
+			def:   "b",
+		},
+		{
+			name:   "bad regex",
+			pools:  testPools("a"),
+			routes: []Route{{Method: &Match{Kind: MatchRegex, Value: "("}, Pool: "a"}},
+		},
+		{
+			name:   "present on the method",
+			pools:  testPools("a"),
+			routes: []Route{{Method: &Match{Kind: MatchPresent}, Pool: "a"}},
+		},
+		{
+			name:   "unknown match kind",
+			pools:  testPools("a"),
+			routes: []Route{{Headers: []HeaderMatch{{Name: "x", Match: Match{Kind: 42}}}, Pool: "a"}},
+		},
+		{
+			name:   "unknown mirror pool",
+			pools:  testPools("a"),
+			routes: []Route{{Pool: "a", Mirror: &Mirror{Pool: "b", Fraction: 1}}},
+		},
+	}
+
+	for _, test := range tests {
+		if _, err := NewTable(test.pools, test.routes, test.def); err == nil {
+			t.Errorf("%s: no error", test.name)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package routeTable
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+
+	"github.com/open-lambda/load-balancer/balancer/serverPick"
+)
+
+// Sticky keys are hashed to one of this many slots, see Split.choose
+const stickySlots = 10000
+
+type PoolWeight struct {
+	Pool   string
+	Weight int
+}
+
+/*
+ * Split divides a route's requests between pools in proportion to their
+ * weights, e.g. 95 to v1 and 5 to v2 for a canary. Weights can be changed
+ * while requests are being routed.
+ */
+type Split struct {
+	mu      sync.RWMutex
+	weights []PoolWeight
+	// Optional, metadata key whose value decides the pool, so a client
+	// sending the same value keeps going to the same pool
+	stickyKey string
+}
+
+func NewSplit(weights []PoolWeight, stickyKey string) (*Split, error) {
+	s := &Split{stickyKey: stickyKey}
+	if err := checkWeights(weights); err != nil {
+		return nil, err
+	}
+	s.weights = append([]PoolWeight(nil), weights...)
+
+	return s, nil
+}
+
+func checkWeights(weights []PoolWeight) error {
+	total := 0
+	for _, pw := range weights {
+		if pw.Weight < 0 {
+			return fmt.Errorf("weight of pool %s is negative", pw.Pool)
+		}
+		total += pw.Weight
+	}
+	if total == 0 {
+		return fmt.Errorf("split has no weight")
+	}
+
+	return nil
+}
+
+// Returns the pools and their current weights
+func (s *Split) Weights() []PoolWeight {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]PoolWeight(nil), s.weights...)
+}
+
+/*
+ * Changes the weights of some of the split's pools, by pool name. Nothing is
+ * changed if a pool isn't part of the split or the weights would all be 0.
+ */
+func (s *Split) SetWeights(weights map[string]int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	updated := append([]PoolWeight(nil), s.weights...)
+	found := 0
+	for i := range updated {
+		if weight, ok := weights[updated[i].Pool]; ok {
+			updated[i].Weight = weight
+			found++
+		}
+	}
+	if found < len(weights) {
+		return fmt.Errorf("split has no pool for some of the weights")
+	}
+	if err := checkWeights(updated); err != nil {
+		return err
+	}
+	s.weights = updated
+
+	return nil
+}
+
+/*
+ * Returns the pool for a request. Sticky keys are hashed to a point in
+ * [0, 1) that is mapped onto the cumulative weights, so moving weight from
+ * one pool to the next only moves the clients between the two.
+ */
+func (s *Split) choose(info *serverPick.PickInfo) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	total := 0
+	for _, pw := range s.weights {
+		total += pw.Weight
+	}
+
+	var point float64
+	if values := info.Metadata[s.stickyKey]; s.stickyKey != "" && len(values) > 0 {
+		h := fnv.New32a()
+		h.Write([]byte(values[0]))
+		point = float64(h.Sum32()%stickySlots) / stickySlots
+	} else {
+		point = rand.Float64()
+	}
+
+	target := point * float64(total)
+	sum := 0
+	for _, pw := range s.weights {
+		sum += pw.Weight
+		if pw.Weight > 0 && target < float64(sum) {
+			return pw.Pool
+		}
+	}
+
+	// Only reached through rounding, fall back on the last pool with weight
+	for i := len(s.weights) - 1; i >= 0; i-- {
+		if s.weights[i].Weight > 0 {
+			return s.weights[i].Pool
+		}
+	}
+	return s.weights[len(s.weights)-1].Pool
+}
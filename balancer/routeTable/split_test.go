@@ -0,0 +1,120 @@
+package routeTable
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/open-lambda/load-balancer/balancer/serverPick"
+)
+
+func TestSplitWeights(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []PoolWeight
+	}{
+		{"even", []PoolWeight{{"a", 1}, {"b", 1}}},
+		{"canary", []PoolWeight{{"v1", 95}, {"v2", 5}}},
+		{"three ways", []PoolWeight{{"a", 1}, {"b", 2}, {"c", 7}}},
+		{"zero weight", []PoolWeight{{"a", 0}, {"b", 3}, {"c", 1}}},
+	}
+
+	const n = 100000
+	for _, test := range tests {
+		split, err := NewSplit(test.weights, "")
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		counts := make(map[string]int)
+		for i := 0; i < n; i++ {
+			counts[split.choose(&serverPick.PickInfo{})]++
+		}
+
+		total := 0
+		for _, pw := range test.weights {
+			total += pw.Weight
+		}
+		for _, pw := range test.weights {
+			want := float64(pw.Weight) / float64(total)
+			got := float64(counts[pw.Pool]) / n
+			if pw.Weight == 0 && counts[pw.Pool] != 0 {
+				t.Errorf("%s: pool %s has no weight but got %d requests", test.name, pw.Pool, counts[pw.Pool])
+			}
+			if math.Abs(got-want) > 0.01 {
+				t.Errorf("%s: pool %s got %.3f of requests, want %.3f", test.name, pw.Pool, got, want)
+			}
+		}
+	}
+}
+
+func stickyInfo(value string) *serverPick.PickInfo {
+	return &serverPick.PickInfo{Metadata: map[string][]string{"x-user": {value}}}
+}
+
+func TestSplitSticky(t *testing.T) {
+	split, err := NewSplit([]PoolWeight{{"v1", 50}, {"v2", 50}}, "x-user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := make(map[string]string)
+	counts := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		pool := split.choose(stickyInfo(user))
+		for j := 0; j < 5; j++ {
+			if again := split.choose(stickyInfo(user)); again != pool {
+				t.Fatalf("%s went to %s then %s", user, pool, again)
+			}
+		}
+		before[user] = pool
+		counts[pool]++
+	}
+	if counts["v1"] < 400 || counts["v2"] < 400 {
+		t.Errorf("sticky keys are spread unevenly: %v", counts)
+	}
+
+	// Moving weight from v1 to v2 only moves clients from v1 to v2
+	if err := split.SetWeights(map[string]int{"v1": 20, "v2": 80}); err != nil {
+		t.Fatal(err)
+	}
+	moved := 0
+	for user, pool := range before {
+		after := split.choose(stickyInfo(user))
+		if pool == "v2" && after != "v2" {
+			t.Errorf("%s moved from v2 to %s", user, after)
+		}
+		if pool != after {
+			moved++
+		}
+	}
+	if moved == 0 {
+		t.Errorf("no client moved to v2")
+	}
+}
+
+func TestSplitErrors(t *testing.T) {
+	if _, err := NewSplit([]PoolWeight{{"a", 0}, {"b", 0}}, ""); err == nil {
+		t.Errorf("split without weight: no error")
+	}
+	if _, err := NewSplit([]PoolWeight{{"a", -1}, {"b", 2}}, ""); err == nil {
+		t.Errorf("negative weight: no error")
+	}
+
+	split, err := NewSplit([]PoolWeight{{"a", 1}, {"b", 1}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := split.SetWeights(map[string]int{"c": 1}); err == nil {
+		t.Errorf("unknown pool: no error")
+	}
+	if err := split.SetWeights(map[string]int{"a": 0, "b": 0}); err == nil {
+		t.Errorf("all weights 0: no error")
+	}
+	want := []PoolWeight{{"a", 1}, {"b", 1}}
+	if got := split.Weights(); !reflect.DeepEqual(got, want) {
+		t.Errorf("failed updates changed the weights to %v", got)
+	}
+}
@@ -0,0 +1,177 @@
+package serverPick
+
+import (
+	"container/list"
+	"math"
+	"sync"
+)
+
+// Load factor suggested by "Consistent Hashing with Bounded Loads" (Mirrokni et al.)
+const DefaultLoadFactor = 1.25
+
+/*
+ * Consistent hashing with bounded loads. Like ConsistentHash, requests with
+ * the same key go to the same server, which for OpenLambda keeps a lambda's
+ * sandbox and imported packages warm on one worker. No server is allowed more
+ * than loadFactor times the average number of in-flight requests though; once
+ * a key's server is full its requests spill over to the next server on the
+ * ring that has room, so a hot lambda can't overload a single worker.
+ */
+type BoundedLoadHash struct {
+	mu         sync.Mutex
+	key        HashKey
+	replicas   int
+	loadFactor float64
+	ring       hashRing
+	servers    []string
+	inflight   map[string]int
+	total      int
+}
+
+/*
+ * replicas is DefaultReplicas if it isn't positive. A loadFactor below 1
+ * leaves too little room for all requests, so DefaultLoadFactor is used then.
+ */
+func NewBoundedLoadHash(servers []string, key HashKey, replicas int, loadFactor float64) *BoundedLoadHash {
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+	if loadFactor < 1 {
+		loadFactor = DefaultLoadFactor
+	}
+	bh := &BoundedLoadHash{
+		key:        key,
+		replicas:   replicas,
+		loadFactor: loadFactor,
+		inflight:   make(map[string]int),
+	}
+	bh.SetServers(servers)
+
+	return bh
+}
+
+/*
+ * Chooses without reserving a slot, so the bound only holds as far as
+ * StartRequest is called before the next request is placed. The balancer
+ * uses Pick instead.
+ */
+func (bh *BoundedLoadHash) ChooseServers(name string, params list.List) (servers []string, err error) {
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+
+	server, err := bh.choose(name, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{server}, nil
+}
+
+/*
+ * Chooses a server and takes a slot on it in one go, so a burst of requests
+ * for the same key can't all see the same load and pile onto one server. The
+ * slot is given back by the result's Done, or by Cancel if the request never
+ * reaches the server.
+ */
+func (bh *BoundedLoadHash) Pick(info *PickInfo) (*PickResult, error) {
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+
+	server, err := bh.choose(info.Method, *pickParams(info))
+	if err != nil {
+		return nil, err
+	}
+	bh.inflight[server]++
+	bh.total++
+
+	// Guarded by bh.mu, whether the reserved slot was used or given back
+	claimed := false
+	return &PickResult{
+		Servers: []string{server},
+		Start: func(started string) {
+			bh.mu.Lock()
+			if !claimed && started == server {
+				claimed = true
+				bh.mu.Unlock()
+				return
+			}
+			bh.mu.Unlock()
+			// Sent to another server as well, e.g. by a retry
+			bh.StartRequest(started)
+		},
+		Done: func(done DoneInfo) {
+			bh.FinishRequest(done.Server)
+		},
+		Cancel: func() {
+			bh.mu.Lock()
+			release := !claimed
+			claimed = true
+			bh.mu.Unlock()
+			if release {
+				bh.FinishRequest(server)
+			}
+		},
+	}, nil
+}
+
+// Returns the first server on the ring with room for one more request, must hold bh.mu
+func (bh *BoundedLoadHash) choose(name string, params list.List) (string, error) {
+	if len(bh.servers) == 0 {
+		return "", ErrNoServers
+	}
+
+	// Requests without the key all hash to the same spot and spread out
+	// through the load bound alone
+	value, _ := hashKeyValue(bh.key, name, params)
+
+	// Capacity counts the request being placed, so there is always at least
+	// one server with room
+	capacity := int(math.Ceil(bh.loadFactor * float64(bh.total+1) / float64(len(bh.servers))))
+	for _, server := range bh.ring.lookup(hashString(value), len(bh.servers)) {
+		if bh.inflight[server] < capacity {
+			return server, nil
+		}
+	}
+
+	return "", ErrOverloaded
+}
+
+func (bh *BoundedLoadHash) RegisterTimes(servers []string, times []float64) {
+	return
+}
+
+func (bh *BoundedLoadHash) SetServers(servers []string) {
+	ring := newHashRing(servers, bh.replicas)
+
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+
+	inflight := make(map[string]int, len(servers))
+	total := 0
+	for _, server := range servers {
+		inflight[server] = bh.inflight[server]
+		total += inflight[server]
+	}
+	bh.servers = servers
+	bh.ring = ring
+	bh.inflight = inflight
+	bh.total = total
+}
+
+func (bh *BoundedLoadHash) StartRequest(server string) {
+	bh.mu.Lock()
+	if _, ok := bh.inflight[server]; ok {
+		bh.inflight[server]++
+		bh.total++
+	}
+	bh.mu.Unlock()
+}
+
+func (bh *BoundedLoadHash) FinishRequest(server string) {
+	bh.mu.Lock()
+	if bh.inflight[server] > 0 {
+		bh.inflight[server]--
+		bh.total--
+	}
+	bh.mu.Unlock()
+}
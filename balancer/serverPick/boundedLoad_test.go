@@ -0,0 +1,143 @@
+package serverPick
+
+import (
+	"math"
+	"sync"
+	"testing"
+)
+
+func inflight(bh *BoundedLoadHash) (map[string]int, int) {
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+
+	counts := make(map[string]int, len(bh.inflight))
+	for server, n := range bh.inflight {
+		counts[server] = n
+	}
+	return counts, bh.total
+}
+
+func TestBoundedLoadConcurrentPicks(t *testing.T) {
+	const picks = 200
+	servers := testServers(4)
+	bh := NewBoundedLoadHash(servers, HashKey{Source: HashMethod}, 0, 1.25)
+
+	// Every request is for the same hot key and none finishes until all
+	// have been placed
+	results := make(chan *PickResult, picks)
+	var wg sync.WaitGroup
+	for i := 0; i < picks; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := bh.Pick(&PickInfo{Method: "/lambda/hot"})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			res.Start(res.Servers[0])
+			results <- res
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	counts, total := inflight(bh)
+	if total != picks {
+		t.Errorf("got %d requests in flight, want %d", total, picks)
+	}
+	capacity := int(math.Ceil(1.25 * picks / float64(len(servers))))
+	for server, n := range counts {
+		if n > capacity {
+			t.Errorf("%s has %d requests, capacity is %d", server, n, capacity)
+		}
+	}
+
+	for res := range results {
+		res.Done(DoneInfo{Server: res.Servers[0]})
+	}
+	if _, total := inflight(bh); total != 0 {
+		t.Errorf("got %d requests in flight after all finished, want 0", total)
+	}
+}
+
+func TestBoundedLoadSpillsOver(t *testing.T) {
+	bh := NewBoundedLoadHash(testServers(2), HashKey{Source: HashMethod}, 0, 1)
+	info := &PickInfo{Method: "/lambda/hot"}
+
+	first, err := bh.Pick(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One request in flight makes the capacity ceil(2/2) = 1, so the key's
+	// server is full and the next request goes to the other one
+	second, err := bh.Pick(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Servers[0] == second.Servers[0] {
+		t.Errorf("both requests went to %s", first.Servers[0])
+	}
+
+	// Once the first is done its server has room again
+	first.Start(first.Servers[0])
+	first.Done(DoneInfo{Server: first.Servers[0]})
+	third, err := bh.Pick(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.Servers[0] != first.Servers[0] {
+		t.Errorf("got %s, want the key's server %s back", third.Servers[0], first.Servers[0])
+	}
+}
+
+func TestBoundedLoadCancel(t *testing.T) {
+	bh := NewBoundedLoadHash(testServers(3), HashKey{Source: HashMethod}, 0, 0)
+
+	res, err := bh.Pick(&PickInfo{Method: "/lambda/a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, total := inflight(bh); total != 1 {
+		t.Fatalf("got %d requests in flight after a pick, want 1", total)
+	}
+
+	// A pick that is never used gives its slot back, once
+	res.Cancel()
+	res.Cancel()
+	if _, total := inflight(bh); total != 0 {
+		t.Errorf("got %d requests in flight after Cancel, want 0", total)
+	}
+
+	// Cancel after Start leaves the slot to Done
+	res, err = bh.Pick(&PickInfo{Method: "/lambda/a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Start(res.Servers[0])
+	res.Cancel()
+	if _, total := inflight(bh); total != 1 {
+		t.Errorf("got %d requests in flight after Start and Cancel, want 1", total)
+	}
+	res.Done(DoneInfo{Server: res.Servers[0]})
+	if _, total := inflight(bh); total != 0 {
+		t.Errorf("got %d requests in flight after Done, want 0", total)
+	}
+}
+
+func TestBoundedLoadNoServers(t *testing.T) {
+	bh := NewBoundedLoadHash(nil, HashKey{Source: HashMethod}, 0, 0)
+	if _, err := bh.Pick(&PickInfo{Method: "/lambda/a"}); err != ErrNoServers {
+		t.Errorf("got error %v, want ErrNoServers", err)
+	}
+	if bh.loadFactor != DefaultLoadFactor || bh.replicas != DefaultReplicas {
+		t.Errorf("got load factor %v and %d replicas, want the defaults", bh.loadFactor, bh.replicas)
+	}
+}
+
+func TestAdaptKeepsPickers(t *testing.T) {
+	bh := NewBoundedLoadHash(testServers(2), HashKey{Source: HashMethod}, 0, 0)
+	if p, ok := Adapt(bh).(*BoundedLoadHash); !ok || p != bh {
+		t.Errorf("Adapt wrapped a ServerPicker that is a Picker already")
+	}
+}
@@ -0,0 +1,167 @@
+package serverPick
+
+import (
+	"container/list"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Where ConsistentHash takes the key to hash from
+const (
+	// The full method name, e.g. /helloworld.Greeter/SayHello
+	HashMethod = iota
+	// A request metadata value, HashKey.Name is the metadata key
+	HashMetadata
+	// A decoded request field, HashKey.Name is the field name
+	HashField
+)
+
+type HashKey struct {
+	Source int
+	Name   string
+}
+
+// Points each server gets on the ring unless the caller asks otherwise
+const DefaultReplicas = 100
+
+// Point on the hash ring owned by a server
+type ringPoint struct {
+	hash   uint64
+	server string
+}
+
+/*
+ * Hash ring with a number of virtual points per server. Adding or removing a
+ * server only moves the keys between its own points and their neighbours.
+ */
+type hashRing []ringPoint
+
+func newHashRing(servers []string, replicas int) hashRing {
+	ring := make(hashRing, 0, len(servers)*replicas)
+	for _, server := range servers {
+		for i := 0; i < replicas; i++ {
+			ring = append(ring, ringPoint{hash: hashString(server + "#" + strconv.Itoa(i)), server: server})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+
+	return ring
+}
+
+// Index of the first point at or after hash, wrapping around the ring
+func (ring hashRing) search(hash uint64) int {
+	i := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= hash })
+	if i == len(ring) {
+		i = 0
+	}
+
+	return i
+}
+
+/*
+ * Walks the ring clockwise from hash and returns up to n distinct servers in
+ * the order they are met.
+ */
+func (ring hashRing) lookup(hash uint64, n int) []string {
+	servers := make([]string, 0, n)
+	seen := make(map[string]bool)
+	start := ring.search(hash)
+	for k := 0; k < len(ring) && len(servers) < n; k++ {
+		server := ring[(start+k)%len(ring)].server
+		if !seen[server] {
+			seen[server] = true
+			servers = append(servers, server)
+		}
+	}
+
+	return servers
+}
+
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+
+	// FNV spreads similar short strings poorly, so finish with the
+	// splitmix64 mixer to scatter the virtual points around the ring
+	x := h.Sum64()
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// Returns the value of key for a request, false if the request doesn't have it
+func hashKeyValue(key HashKey, name string, params list.List) (string, bool) {
+	switch key.Source {
+	case HashMethod:
+		return name, true
+	case HashMetadata:
+		return ParamValue(params, MetadataParam, key.Name)
+	case HashField:
+		return ParamValue(params, FieldParam, key.Name)
+	}
+
+	return "", false
+}
+
+/*
+ * Sends requests with the same key to the same server. The server the key
+ * hashes to comes first, followed by the next server on the ring as a
+ * fallback. Requests without the key go to a random server.
+ */
+type ConsistentHash struct {
+	mu       sync.RWMutex
+	key      HashKey
+	replicas int
+	ring     hashRing
+	servers  []string
+	rgmu     sync.Mutex
+	rg       *rand.Rand
+}
+
+// replicas is DefaultReplicas if it isn't positive
+func NewConsistentHash(servers []string, key HashKey, replicas int) *ConsistentHash {
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+	src := rand.NewSource(time.Now().UnixNano())
+	ch := &ConsistentHash{key: key, replicas: replicas, rg: rand.New(src)}
+	ch.SetServers(servers)
+
+	return ch
+}
+
+func (ch *ConsistentHash) ChooseServers(name string, params list.List) (servers []string, err error) {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	if len(ch.servers) == 0 {
+		return nil, ErrNoServers
+	}
+
+	value, ok := hashKeyValue(ch.key, name, params)
+	if !ok {
+		ch.rgmu.Lock()
+		index := ch.rg.Intn(len(ch.servers))
+		ch.rgmu.Unlock()
+		return []string{ch.servers[index]}, nil
+	}
+
+	return ch.ring.lookup(hashString(value), 2), nil
+}
+
+func (ch *ConsistentHash) RegisterTimes(servers []string, times []float64) {
+	return
+}
+
+func (ch *ConsistentHash) SetServers(servers []string) {
+	ring := newHashRing(servers, ch.replicas)
+
+	ch.mu.Lock()
+	ch.servers = servers
+	ch.ring = ring
+	ch.mu.Unlock()
+}
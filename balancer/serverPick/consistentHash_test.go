@@ -0,0 +1,183 @@
+package serverPick
+
+import (
+	"container/list"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func hashParams(params ...Param) list.List {
+	l := list.New()
+	for _, p := range params {
+		l.PushBack(p)
+	}
+	return *l
+}
+
+func testServers(n int) []string {
+	servers := make([]string, n)
+	for i := range servers {
+		servers[i] = fmt.Sprintf("10.0.0.%d:50051", i+1)
+	}
+	return servers
+}
+
+// Returns the first server each of n keys hashes to
+func placement(t *testing.T, ch *ConsistentHash, n int) map[string]string {
+	owners := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		servers, err := ch.ChooseServers(key, list.List{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		owners[key] = servers[0]
+	}
+	return owners
+}
+
+func TestConsistentHashKeys(t *testing.T) {
+	servers := testServers(4)
+	tests := []struct {
+		name   string
+		key    HashKey
+		method string
+		params list.List
+		same   list.List
+	}{
+		{
+			name:   "method",
+			key:    HashKey{Source: HashMethod},
+			method: "/shop.Orders/Get",
+		},
+		{
+			name:   "metadata",
+			key:    HashKey{Source: HashMetadata, Name: "x-user"},
+			params: hashParams(Param{Kind: MetadataParam, Key: "x-user", Value: "alice"}),
+			// Other params don't change where the key goes
+			same: hashParams(
+				Param{Kind: FieldParam, Key: "x-user", Value: "bob"},
+				Param{Kind: MetadataParam, Key: "x-user", Value: "alice"},
+			),
+		},
+		{
+			name:   "field",
+			key:    HashKey{Source: HashField, Name: "id"},
+			params: hashParams(Param{Kind: FieldParam, Key: "id", Value: "42"}),
+			same: hashParams(
+				Param{Kind: MetadataParam, Key: "other", Value: "1"},
+				Param{Kind: FieldParam, Key: "id", Value: "42"},
+			),
+		},
+	}
+
+	for _, test := range tests {
+		ch := NewConsistentHash(servers, test.key, 0)
+		first, err := ch.ChooseServers(test.method, test.params)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if len(first) != 2 || first[0] == first[1] {
+			t.Errorf("%s: got %v, want two distinct servers", test.name, first)
+		}
+
+		for i := 0; i < 10; i++ {
+			params := test.params
+			if test.same.Len() > 0 && i%2 == 1 {
+				params = test.same
+			}
+			again, err := ch.ChooseServers(test.method, params)
+			if err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+			if !reflect.DeepEqual(again, first) {
+				t.Errorf("%s: got %v, then %v", test.name, first, again)
+				break
+			}
+		}
+	}
+}
+
+func TestConsistentHashMissingKey(t *testing.T) {
+	ch := NewConsistentHash(testServers(4), HashKey{Source: HashMetadata, Name: "x-user"}, 0)
+
+	seen := make(map[string]bool)
+	for i := 0; i < 200; i++ {
+		servers, err := ch.ChooseServers("/shop.Orders/Get", list.List{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(servers) != 1 {
+			t.Fatalf("got %v, want one random server", servers)
+		}
+		seen[servers[0]] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("requests without the key all went to %v", seen)
+	}
+}
+
+func TestConsistentHashPlacement(t *testing.T) {
+	const keys = 10000
+	servers := testServers(5)
+	ch := NewConsistentHash(servers, HashKey{Source: HashMethod}, 0)
+	before := placement(t, ch, keys)
+
+	counts := make(map[string]int)
+	for _, server := range before {
+		counts[server]++
+	}
+	for _, server := range servers {
+		// An even share is 2000, the virtual points keep every server near it
+		if counts[server] < 1200 || counts[server] > 2800 {
+			t.Errorf("%s owns %d of %d keys", server, counts[server], keys)
+		}
+	}
+
+	// Removing a server only moves the keys it owned
+	removed := servers[2]
+	ch.SetServers(append(append([]string(nil), servers[:2]...), servers[3:]...))
+	for key, server := range placement(t, ch, keys) {
+		if before[key] != removed && server != before[key] {
+			t.Errorf("%s moved from %s to %s", key, before[key], server)
+		}
+		if server == removed {
+			t.Errorf("%s still goes to the removed server", key)
+		}
+	}
+
+	// Adding a server only moves keys to it
+	ch.SetServers(append(servers, "10.0.0.6:50051"))
+	moved := 0
+	for key, server := range placement(t, ch, keys) {
+		if server != before[key] {
+			if server != "10.0.0.6:50051" {
+				t.Errorf("%s moved from %s to %s", key, before[key], server)
+			}
+			moved++
+		}
+	}
+	if moved < keys/12 || moved > keys/3 {
+		t.Errorf("adding a sixth server moved %d of %d keys", moved, keys)
+	}
+}
+
+func TestConsistentHashNoServers(t *testing.T) {
+	ch := NewConsistentHash(nil, HashKey{Source: HashMethod}, 0)
+	if _, err := ch.ChooseServers("/shop.Orders/Get", list.List{}); err != ErrNoServers {
+		t.Errorf("got error %v, want ErrNoServers", err)
+	}
+
+	ch = NewConsistentHash([]string{"a"}, HashKey{Source: HashMethod}, -1)
+	if ch.replicas != DefaultReplicas {
+		t.Errorf("got %d replicas, want %d", ch.replicas, DefaultReplicas)
+	}
+	servers, err := ch.ChooseServers("/shop.Orders/Get", list.List{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(servers) != 1 || servers[0] != "a" {
+		t.Errorf("got %v, want [a]", servers)
+	}
+}
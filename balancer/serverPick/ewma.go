@@ -0,0 +1,151 @@
+package serverPick
+
+import (
+	"container/list"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Latency assumed for a server until its first request finishes, in seconds
+const ewmaInitialLatency = 0.01
+
+// Decay used unless the caller asks otherwise
+const DefaultDecay = 10 * time.Second
+
+// Latency and load of one server as seen by EWMAPicker
+type ewmaStats struct {
+	latency  float64
+	inflight int
+	updated  time.Time
+}
+
+/*
+ * Picks the server with the lowest expected cost, where the cost is the
+ * server's moving average latency times the number of requests it would be
+ * handling (peak-EWMA). Slow samples are taken as-is so a server that starts
+ * struggling is avoided right away, while fast samples only pull the average
+ * down gradually. While a server gets no samples its average fades back to
+ * the initial latency, so one slow request doesn't keep it idle for good.
+ */
+type EWMAPicker struct {
+	mu      sync.Mutex
+	rg      *rand.Rand
+	decay   time.Duration
+	servers []string
+	stats   map[string]*ewmaStats
+}
+
+/*
+ * decay is how long it takes for an old latency sample to lose most of its
+ * weight, DefaultDecay if it isn't positive.
+ */
+func NewEWMAPicker(servers []string, decay time.Duration) *EWMAPicker {
+	if decay <= 0 {
+		decay = DefaultDecay
+	}
+	src := rand.NewSource(time.Now().UnixNano())
+	ep := &EWMAPicker{
+		rg:    rand.New(src),
+		decay: decay,
+		stats: make(map[string]*ewmaStats),
+	}
+	ep.SetServers(servers)
+
+	return ep
+}
+
+func (ep *EWMAPicker) ChooseServers(name string, params list.List) (servers []string, err error) {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+
+	if len(ep.servers) == 0 {
+		return nil, ErrNoServers
+	}
+
+	now := time.Now()
+	best := ""
+	bestCost := math.Inf(1)
+	ties := 0
+	for _, server := range ep.servers {
+		st := ep.stats[server]
+		cost := ep.latency(st, now) * float64(st.inflight+1)
+		switch {
+		case cost < bestCost:
+			best, bestCost, ties = server, cost, 1
+		case cost == bestCost:
+			// Spread ties evenly instead of always favoring the first server
+			ties++
+			if ep.rg.Intn(ties) == 0 {
+				best = server
+			}
+		}
+	}
+
+	return []string{best}, nil
+}
+
+func (ep *EWMAPicker) RegisterTimes(servers []string, times []float64) {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+
+	now := time.Now()
+	for i, server := range servers {
+		st, ok := ep.stats[server]
+		if !ok {
+			continue
+		}
+
+		current := ep.latency(st, now)
+		if times[i] > current {
+			st.latency = times[i]
+		} else {
+			w := math.Exp(-float64(now.Sub(st.updated)) / float64(ep.decay))
+			st.latency = current*w + times[i]*(1-w)
+		}
+		st.updated = now
+	}
+}
+
+/*
+ * The server's average latency as of now, decayed towards the initial latency
+ * for as long as it has gone without a sample, like Finagle's peak-EWMA.
+ */
+func (ep *EWMAPicker) latency(st *ewmaStats, now time.Time) float64 {
+	w := math.Exp(-float64(now.Sub(st.updated)) / float64(ep.decay))
+	return st.latency*w + ewmaInitialLatency*(1-w)
+}
+
+func (ep *EWMAPicker) SetServers(servers []string) {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+
+	// Keep what we've learned about servers that are still around
+	stats := make(map[string]*ewmaStats, len(servers))
+	for _, server := range servers {
+		if st, ok := ep.stats[server]; ok {
+			stats[server] = st
+		} else {
+			stats[server] = &ewmaStats{latency: ewmaInitialLatency, updated: time.Now()}
+		}
+	}
+	ep.servers = servers
+	ep.stats = stats
+}
+
+func (ep *EWMAPicker) StartRequest(server string) {
+	ep.mu.Lock()
+	if st, ok := ep.stats[server]; ok {
+		st.inflight++
+	}
+	ep.mu.Unlock()
+}
+
+func (ep *EWMAPicker) FinishRequest(server string) {
+	ep.mu.Lock()
+	if st, ok := ep.stats[server]; ok && st.inflight > 0 {
+		st.inflight--
+	}
+	ep.mu.Unlock()
+}
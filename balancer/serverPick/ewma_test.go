@@ -0,0 +1,134 @@
+package serverPick
+
+import (
+	"container/list"
+	"testing"
+	"time"
+)
+
+func pickOne(t *testing.T, ep *EWMAPicker) string {
+	servers, err := ep.ChooseServers("", list.List{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return servers[0]
+}
+
+// Makes the server's last sample look like it came in ago
+func backdate(ep *EWMAPicker, server string, ago time.Duration) {
+	ep.mu.Lock()
+	ep.stats[server].updated = time.Now().Add(-ago)
+	ep.mu.Unlock()
+}
+
+func TestEWMACost(t *testing.T) {
+	tests := []struct {
+		name     string
+		latency  map[string]float64
+		inflight map[string]int
+		want     string
+	}{
+		{
+			name:    "lower latency",
+			latency: map[string]float64{"a": 0.1, "b": 0.05},
+			want:    "b",
+		},
+		{
+			// 0.1 * 1 beats 0.05 * 3
+			name:     "lower latency times in flight",
+			latency:  map[string]float64{"a": 0.1, "b": 0.05},
+			inflight: map[string]int{"b": 2},
+			want:     "a",
+		},
+		{
+			// 0.1 * 2 loses to 0.05 * 3
+			name:     "in flight on both",
+			latency:  map[string]float64{"a": 0.1, "b": 0.05},
+			inflight: map[string]int{"a": 1, "b": 2},
+			want:     "b",
+		},
+		{
+			name:     "unmeasured server",
+			latency:  map[string]float64{"a": 0.1},
+			inflight: map[string]int{"b": 5},
+			want:     "b",
+		},
+	}
+
+	for _, test := range tests {
+		ep := NewEWMAPicker([]string{"a", "b"}, time.Hour)
+		for server, latency := range test.latency {
+			ep.RegisterTimes([]string{server}, []float64{latency})
+		}
+		for server, n := range test.inflight {
+			for i := 0; i < n; i++ {
+				ep.StartRequest(server)
+			}
+		}
+		if got := pickOne(t, ep); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestEWMAPeak(t *testing.T) {
+	ep := NewEWMAPicker([]string{"a", "b"}, time.Hour)
+	ep.RegisterTimes([]string{"a", "b"}, []float64{0.02, 0.03})
+	if got := pickOne(t, ep); got != "a" {
+		t.Fatalf("got %s, want a", got)
+	}
+
+	// A slow sample counts in full right away
+	ep.RegisterTimes([]string{"a"}, []float64{1})
+	if got := pickOne(t, ep); got != "b" {
+		t.Errorf("got %s after a slow sample on a, want b", got)
+	}
+}
+
+func TestEWMASlowServerRecovers(t *testing.T) {
+	decay := time.Second
+	ep := NewEWMAPicker([]string{"a", "b"}, decay)
+
+	// One stall on a, e.g. a GC pause, and b is steady a little above the
+	// initial latency
+	ep.RegisterTimes([]string{"a", "b"}, []float64{5, 0.02})
+	if got := pickOne(t, ep); got != "b" {
+		t.Fatalf("got %s right after a stalled, want b", got)
+	}
+
+	// With no samples since, a's latency fades back towards the initial
+	// latency and it gets picked again
+	backdate(ep, "a", 10*decay)
+	if got := pickOne(t, ep); got != "a" {
+		t.Errorf("got %s long after a stalled, want a", got)
+	}
+
+	// A fast sample then keeps it there
+	ep.RegisterTimes([]string{"a"}, []float64{0.005})
+	if got := pickOne(t, ep); got != "a" {
+		t.Errorf("got %s after a fast sample on a, want a", got)
+	}
+}
+
+func TestEWMASetServers(t *testing.T) {
+	ep := NewEWMAPicker([]string{"a", "b"}, 0)
+	if ep.decay != DefaultDecay {
+		t.Errorf("got decay %v, want %v", ep.decay, DefaultDecay)
+	}
+
+	ep.RegisterTimes([]string{"a"}, []float64{1})
+	ep.SetServers([]string{"a"})
+	if got := pickOne(t, ep); got != "a" {
+		t.Errorf("got %s, want the only server a", got)
+	}
+	// What was learned about a is kept
+	ep.SetServers([]string{"a", "c"})
+	if got := pickOne(t, ep); got != "c" {
+		t.Errorf("got %s, want c over the slow a", got)
+	}
+
+	ep.SetServers(nil)
+	if _, err := ep.ChooseServers("", list.List{}); err != ErrNoServers {
+		t.Errorf("got error %v, want ErrNoServers", err)
+	}
+}
@@ -0,0 +1,88 @@
+package serverPick
+
+import (
+	"container/list"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+/*
+ * Power of two choices: samples two different servers at random and picks the
+ * one with fewer outstanding requests. This avoids the pile-ups RandPicker
+ * causes under load without the herding of always picking the least loaded
+ * server.
+ */
+type P2CPicker struct {
+	mu       sync.Mutex
+	rg       *rand.Rand
+	servers  []string
+	inflight map[string]int
+}
+
+func NewP2CPicker(servers []string) *P2CPicker {
+	src := rand.NewSource(time.Now().UnixNano())
+	pp := &P2CPicker{rg: rand.New(src), inflight: make(map[string]int)}
+	pp.SetServers(servers)
+
+	return pp
+}
+
+func (pp *P2CPicker) ChooseServers(name string, params list.List) (servers []string, err error) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+
+	switch len(pp.servers) {
+	case 0:
+		return nil, ErrNoServers
+	case 1:
+		return []string{pp.servers[0]}, nil
+	}
+
+	// Second index is drawn from the remaining n-1 servers so it never
+	// matches the first
+	i := pp.rg.Intn(len(pp.servers))
+	j := pp.rg.Intn(len(pp.servers) - 1)
+	if j >= i {
+		j++
+	}
+
+	a, b := pp.servers[i], pp.servers[j]
+	if pp.inflight[b] < pp.inflight[a] {
+		a = b
+	}
+
+	return []string{a}, nil
+}
+
+func (pp *P2CPicker) RegisterTimes(servers []string, times []float64) {
+	return
+}
+
+func (pp *P2CPicker) SetServers(servers []string) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+
+	inflight := make(map[string]int, len(servers))
+	for _, server := range servers {
+		inflight[server] = pp.inflight[server]
+	}
+	pp.servers = servers
+	pp.inflight = inflight
+}
+
+func (pp *P2CPicker) StartRequest(server string) {
+	pp.mu.Lock()
+	if _, ok := pp.inflight[server]; ok {
+		pp.inflight[server]++
+	}
+	pp.mu.Unlock()
+}
+
+func (pp *P2CPicker) FinishRequest(server string) {
+	pp.mu.Lock()
+	if pp.inflight[server] > 0 {
+		pp.inflight[server]--
+	}
+	pp.mu.Unlock()
+}
@@ -0,0 +1,114 @@
+package serverPick
+
+import (
+	"container/list"
+	"math/rand"
+	"testing"
+)
+
+func seededP2C(servers []string) *P2CPicker {
+	pp := NewP2CPicker(servers)
+	pp.rg = rand.New(rand.NewSource(1))
+	return pp
+}
+
+func TestP2C(t *testing.T) {
+	tests := []struct {
+		name     string
+		servers  []string
+		inflight map[string]int
+		// Servers that may be picked
+		want map[string]bool
+	}{
+		{
+			name:    "single server",
+			servers: []string{"a"},
+			want:    map[string]bool{"a": true},
+		},
+		{
+			name:     "single busy server",
+			servers:  []string{"a"},
+			inflight: map[string]int{"a": 10},
+			want:     map[string]bool{"a": true},
+		},
+		{
+			name:     "less loaded of two",
+			servers:  []string{"a", "b"},
+			inflight: map[string]int{"a": 3, "b": 1},
+			want:     map[string]bool{"b": true},
+		},
+		{
+			name:     "less loaded of two, other order",
+			servers:  []string{"a", "b"},
+			inflight: map[string]int{"a": 1, "b": 3},
+			want:     map[string]bool{"a": true},
+		},
+		{
+			// The busiest server loses to whichever server it is paired with
+			name:     "busiest of three",
+			servers:  []string{"a", "b", "c"},
+			inflight: map[string]int{"a": 1, "b": 5, "c": 2},
+			want:     map[string]bool{"a": true, "c": true},
+		},
+	}
+
+	for _, test := range tests {
+		pp := seededP2C(test.servers)
+		for server, n := range test.inflight {
+			for i := 0; i < n; i++ {
+				pp.StartRequest(server)
+			}
+		}
+		for i := 0; i < 100; i++ {
+			servers, err := pp.ChooseServers("", list.List{})
+			if err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+			if len(servers) != 1 || !test.want[servers[0]] {
+				t.Errorf("%s: got %v, want one of %v", test.name, servers, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestP2CSpreadsTies(t *testing.T) {
+	pp := seededP2C([]string{"a", "b", "c"})
+	counts := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		servers, err := pp.ChooseServers("", list.List{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[servers[0]]++
+	}
+	for _, server := range []string{"a", "b", "c"} {
+		if counts[server] < 800 {
+			t.Errorf("idle servers picked unevenly: %v", counts)
+			break
+		}
+	}
+}
+
+func TestP2CTracksRequests(t *testing.T) {
+	pp := seededP2C([]string{"a", "b"})
+	pp.StartRequest("a")
+	pp.StartRequest("a")
+	pp.FinishRequest("a")
+	pp.FinishRequest("b")
+	if pp.inflight["a"] != 1 || pp.inflight["b"] != 0 {
+		t.Errorf("got in flight %v, want a 1 and b 0", pp.inflight)
+	}
+
+	// Servers that leave take their counts with them
+	pp.SetServers([]string{"b"})
+	pp.SetServers([]string{"a", "b"})
+	if pp.inflight["a"] != 0 {
+		t.Errorf("a came back with %d requests in flight, want 0", pp.inflight["a"])
+	}
+
+	pp.SetServers(nil)
+	if _, err := pp.ChooseServers("", list.List{}); err != ErrNoServers {
+		t.Errorf("got error %v, want ErrNoServers", err)
+	}
+}
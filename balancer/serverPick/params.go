@@ -0,0 +1,33 @@
+package serverPick
+
+import "container/list"
+
+// Where a Param's value came from
+const (
+	// Request metadata (headers), keys are lower case
+	MetadataParam = iota
+	// A field decoded from the request message
+	FieldParam
+)
+
+/*
+ * Element type of the params list passed to ChooseServers. The balancer adds
+ * one Param per value, so a metadata key sent several times shows up several
+ * times.
+ */
+type Param struct {
+	Kind  int
+	Key   string
+	Value string
+}
+
+// Returns the first value of the given kind and key in params
+func ParamValue(params list.List, kind int, key string) (string, bool) {
+	for e := params.Front(); e != nil; e = e.Next() {
+		if p, ok := e.Value.(Param); ok && p.Kind == kind && p.Key == key {
+			return p.Value, true
+		}
+	}
+
+	return "", false
+}
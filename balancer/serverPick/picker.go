@@ -0,0 +1,139 @@
+package serverPick
+
+import (
+	"container/list"
+	"net"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// Everything the balancer knows about a request when it picks a server for it
+type PickInfo struct {
+	// Full method name, e.g. /helloworld.Greeter/SayHello
+	Method string
+	// Request metadata, keys are lower case
+	Metadata map[string][]string
+	// :authority the client sent, usually the host it dialed
+	Authority string
+	// Address of the client
+	Peer net.Addr
+	// When the client gives up on the request, zero if it never does
+	Deadline time.Time
+	// Request fields decoded by msgPeek, empty if the method isn't known
+	Fields map[string]string
+	// 0 for the first pick of a request, counts up on retries
+	Attempt int
+}
+
+// Outcome of sending a request to one server
+type DoneInfo struct {
+	Server string
+	// Status code sent to the client
+	Code codes.Code
+	// Whether the server ended the stream with its own status, as opposed to
+	// the balancer giving up on it or the client going away
+	Completed bool
+	// From forwarding the request to the server's trailers
+	Latency       time.Duration
+	BytesSent     int64
+	BytesReceived int64
+}
+
+type PickResult struct {
+	// Servers to send the request to, best first
+	Servers []string
+	// Called right before the request is sent to a server, may be nil
+	Start func(server string)
+	// Called once for every server Start was called for, may be nil
+	Done func(info DoneInfo)
+	// Called instead of Start if the request never reaches a server, e.g.
+	// the client went away first, may be nil
+	Cancel func()
+	// Optional, where to send a copy of the request
+	Mirror *MirrorResult
+}
+
+/*
+ * A server to send a copy of the request to, whose response is thrown away.
+ * Start and Done are only called if the copy is sent, Cancel otherwise.
+ */
+type MirrorResult struct {
+	PickResult
+	// Called once both the request and its copy are over, may be nil. The
+	// primary's Server is empty, as it may have been tried on several.
+	Compare func(primary DoneInfo, shadow DoneInfo)
+}
+
+/*
+ * Picker is the successor of ServerPicker. It sees the whole request context
+ * instead of a name and a list, and learns how each request went through the
+ * result's callbacks rather than separate RegisterTimes calls. Adapt turns a
+ * ServerPicker into a Picker.
+ */
+type Picker interface {
+	Pick(info *PickInfo) (*PickResult, error)
+	// Replaces the servers to choose from, e.g. when one fails a health check
+	SetServers(servers []string)
+}
+
+/*
+ * Wraps a ServerPicker so the balancer can use it as a Picker. ServerPickers
+ * that are Pickers already, e.g. BoundedLoadHash, are returned as they are.
+ */
+func Adapt(sp ServerPicker) Picker {
+	if p, ok := sp.(Picker); ok {
+		return p
+	}
+	return &adapter{sp: sp}
+}
+
+type adapter struct {
+	sp ServerPicker
+}
+
+func (a *adapter) Pick(info *PickInfo) (*PickResult, error) {
+	servers, err := a.sp.ChooseServers(info.Method, *pickParams(info))
+	if err != nil {
+		return nil, err
+	}
+
+	res := &PickResult{Servers: servers}
+	tracker, tracking := a.sp.(RequestTracker)
+	if tracking {
+		res.Start = tracker.StartRequest
+	}
+	res.Done = func(done DoneInfo) {
+		if tracking {
+			tracker.FinishRequest(done.Server)
+		}
+		// Only time requests the server actually answered, a stream the
+		// client gave up on says nothing about how fast the server is
+		if done.Completed {
+			a.sp.RegisterTimes([]string{done.Server}, []float64{done.Latency.Seconds()})
+		}
+	}
+
+	return res, nil
+}
+
+func (a *adapter) SetServers(servers []string) {
+	if ss, ok := a.sp.(ServerSetter); ok {
+		ss.SetServers(servers)
+	}
+}
+
+// Flattens the metadata and fields of a request into ChooseServers params
+func pickParams(info *PickInfo) *list.List {
+	params := list.New()
+	for key, values := range info.Metadata {
+		for _, value := range values {
+			params.PushBack(Param{Kind: MetadataParam, Key: key, Value: value})
+		}
+	}
+	for key, value := range info.Fields {
+		params.PushBack(Param{Kind: FieldParam, Key: key, Value: value})
+	}
+
+	return params
+}
@@ -0,0 +1,128 @@
+package serverPick
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Picks servers in turn
+type RoundRobin struct {
+	mu      sync.Mutex
+	next    int
+	servers []string
+}
+
+func NewRoundRobin(servers []string) *RoundRobin {
+	return &RoundRobin{servers: servers}
+}
+
+func (rr *RoundRobin) ChooseServers(name string, params list.List) (servers []string, err error) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	if len(rr.servers) == 0 {
+		return nil, ErrNoServers
+	}
+	rr.next %= len(rr.servers)
+	server := rr.servers[rr.next]
+	rr.next++
+
+	return []string{server}, nil
+}
+
+func (rr *RoundRobin) RegisterTimes(servers []string, times []float64) {
+	return
+}
+
+// The rotation carries on from the same position rather than starting over
+func (rr *RoundRobin) SetServers(servers []string) {
+	rr.mu.Lock()
+	rr.servers = servers
+	rr.mu.Unlock()
+}
+
+/*
+ * Smooth weighted round robin as done by nginx: a server with weight 3 is
+ * picked three times as often as one with weight 1, and picks of the heavier
+ * server are spread out rather than sent in a burst.
+ */
+type WeightedRoundRobin struct {
+	mu      sync.Mutex
+	servers []string
+	weights map[string]int
+	current map[string]int
+}
+
+// Servers missing from weights get a weight of 1
+func NewWeightedRoundRobin(servers []string, weights map[string]int) *WeightedRoundRobin {
+	wrr := &WeightedRoundRobin{
+		weights: make(map[string]int),
+		current: make(map[string]int),
+	}
+	for server, weight := range weights {
+		wrr.weights[server] = weight
+	}
+	wrr.SetServers(servers)
+
+	return wrr
+}
+
+func (wrr *WeightedRoundRobin) ChooseServers(name string, params list.List) (servers []string, err error) {
+	wrr.mu.Lock()
+	defer wrr.mu.Unlock()
+
+	best := ""
+	total := 0
+	for _, server := range wrr.servers {
+		weight := wrr.weight(server)
+		if weight <= 0 {
+			continue
+		}
+		wrr.current[server] += weight
+		total += weight
+		if best == "" || wrr.current[server] > wrr.current[best] {
+			best = server
+		}
+	}
+	if best == "" {
+		return nil, ErrNoServers
+	}
+	wrr.current[best] -= total
+
+	return []string{best}, nil
+}
+
+func (wrr *WeightedRoundRobin) RegisterTimes(servers []string, times []float64) {
+	return
+}
+
+func (wrr *WeightedRoundRobin) SetServers(servers []string) {
+	wrr.mu.Lock()
+	defer wrr.mu.Unlock()
+
+	current := make(map[string]int, len(servers))
+	for _, server := range servers {
+		current[server] = wrr.current[server]
+	}
+	wrr.servers = servers
+	wrr.current = current
+}
+
+/*
+ * Changes the weight of a server. The rotation isn't reset, so the new weight
+ * takes effect smoothly from the next pick on. A weight of 0 stops the server
+ * from being picked.
+ */
+func (wrr *WeightedRoundRobin) SetWeight(server string, weight int) {
+	wrr.mu.Lock()
+	wrr.weights[server] = weight
+	wrr.mu.Unlock()
+}
+
+func (wrr *WeightedRoundRobin) weight(server string) int {
+	if weight, ok := wrr.weights[server]; ok {
+		return weight
+	}
+
+	return 1
+}
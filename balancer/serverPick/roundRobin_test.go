@@ -0,0 +1,116 @@
+package serverPick
+
+import (
+	"container/list"
+	"reflect"
+	"testing"
+)
+
+type chooser interface {
+	ChooseServers(name string, params list.List) ([]string, error)
+}
+
+func choose(t *testing.T, c chooser, n int) []string {
+	picks := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		servers, err := c.ChooseServers("", list.List{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(servers) != 1 {
+			t.Fatalf("got servers %v, want one", servers)
+		}
+		picks = append(picks, servers[0])
+	}
+	return picks
+}
+
+func TestRoundRobin(t *testing.T) {
+	rr := NewRoundRobin([]string{"a", "b", "c"})
+	if got, want := choose(t, rr, 4), []string{"a", "b", "c", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	rr.SetServers([]string{"a", "b"})
+	if got, want := choose(t, rr, 3), []string{"b", "a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after SetServers got %v, want %v", got, want)
+	}
+
+	rr.SetServers(nil)
+	if _, err := rr.ChooseServers("", list.List{}); err != ErrNoServers {
+		t.Errorf("got error %v, want ErrNoServers", err)
+	}
+}
+
+func TestWeightedRoundRobin(t *testing.T) {
+	tests := []struct {
+		name    string
+		servers []string
+		weights map[string]int
+		want    []string
+	}{
+		{
+			name:    "unweighted",
+			servers: []string{"a", "b", "c"},
+			want:    []string{"a", "b", "c", "a", "b", "c"},
+		},
+		{
+			// The sequence nginx gives for these weights
+			name:    "smooth",
+			servers: []string{"a", "b", "c"},
+			weights: map[string]int{"a": 5},
+			want:    []string{"a", "a", "b", "a", "c", "a", "a"},
+		},
+		{
+			name:    "two to one",
+			servers: []string{"a", "b"},
+			weights: map[string]int{"a": 1, "b": 2},
+			want:    []string{"b", "a", "b", "b", "a", "b"},
+		},
+		{
+			name:    "zero weight",
+			servers: []string{"a", "b", "c"},
+			weights: map[string]int{"b": 0},
+			want:    []string{"a", "c", "a", "c"},
+		},
+		{
+			name:    "weights of servers not in the list",
+			servers: []string{"a", "b"},
+			weights: map[string]int{"z": 10},
+			want:    []string{"a", "b", "a", "b"},
+		},
+	}
+
+	for _, test := range tests {
+		wrr := NewWeightedRoundRobin(test.servers, test.weights)
+		if got := choose(t, wrr, len(test.want)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestWeightedRoundRobinUpdates(t *testing.T) {
+	wrr := NewWeightedRoundRobin([]string{"a", "b"}, nil)
+
+	wrr.SetWeight("a", 3)
+	counts := make(map[string]int)
+	for _, server := range choose(t, wrr, 400) {
+		counts[server]++
+	}
+	if counts["a"] != 300 || counts["b"] != 100 {
+		t.Errorf("got %v, want a 300 times and b 100 times", counts)
+	}
+
+	wrr.SetServers([]string{"b", "c"})
+	for _, server := range choose(t, wrr, 10) {
+		if server == "a" {
+			t.Fatalf("picked a after it was removed")
+		}
+	}
+
+	wrr.SetWeight("b", 0)
+	wrr.SetWeight("c", 0)
+	if _, err := wrr.ChooseServers("", list.List{}); err != ErrNoServers {
+		t.Errorf("got error %v, want ErrNoServers", err)
+	}
+}
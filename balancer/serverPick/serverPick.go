@@ -2,48 +2,121 @@ package serverPick
 
 import (
 	"container/list"
+	"errors"
 	"math/rand"
+	"sync"
 	"time"
 )
 
+var (
+	// Returned when a picker has no servers to choose from
+	ErrNoServers = errors.New("no servers available")
+	// Returned when every server is too busy to take another request
+	ErrOverloaded = errors.New("all servers are overloaded")
+	// Returned when no route sends the request anywhere
+	ErrNoRoute = errors.New("no route for request")
+)
+
 type ServerPicker interface {
 	ChooseServers(name string, params list.List) (servers []string, err error)
+	// Reports how long requests to servers took, in seconds, measured from
+	// the balancer forwarding the request to the backend's trailers
 	RegisterTimes(servers []string, times []float64)
 }
 
-// Always picks first two servers
+/*
+ * Optionally implemented by ServerPickers whose servers can change while they
+ * run, e.g. when one fails a health check. Pickers without it keep choosing
+ * from the servers they were built with.
+ */
+type ServerSetter interface {
+	SetServers(servers []string)
+}
+
+/*
+ * Optionally implemented by pickers that need to know how many requests each
+ * server is handling. The balancer calls StartRequest before forwarding a
+ * request to a server and FinishRequest once the stream is over.
+ */
+type RequestTracker interface {
+	StartRequest(server string)
+	FinishRequest(server string)
+}
+
+/*
+ * Always picks first two servers. Copies share their servers, so a copy
+ * given to the balancer sees SetServers calls on the original.
+ */
 type FirstTwo struct {
+	list *serverList
+}
+
+type serverList struct {
+	mu      sync.RWMutex
 	servers []string
 }
 
 func NewFirstTwo(servers []string) FirstTwo {
-	return *&FirstTwo{servers: servers}
+	return FirstTwo{list: &serverList{servers: servers}}
 }
 
 func (ft FirstTwo) ChooseServers(name string, params list.List) (servers []string, err error) {
-	return []string{ft.servers[0], ft.servers[1]}, nil
+	ft.list.mu.RLock()
+	defer ft.list.mu.RUnlock()
+
+	switch len(ft.list.servers) {
+	case 0:
+		return nil, ErrNoServers
+	case 1:
+		return []string{ft.list.servers[0]}, nil
+	}
+	return []string{ft.list.servers[0], ft.list.servers[1]}, nil
 }
 
 func (ft FirstTwo) RegisterTimes(servers []string, times []float64) {
 	return
 }
 
-// Picks only one server randomly
+func (ft FirstTwo) SetServers(servers []string) {
+	ft.list.mu.Lock()
+	ft.list.servers = servers
+	ft.list.mu.Unlock()
+}
+
+// Picks only one server randomly; copies share their servers like FirstTwo
 type RandPicker struct {
-	rg      rand.Rand
+	state *randState
+}
+
+type randState struct {
+	mu      sync.Mutex
+	rg      *rand.Rand
 	servers []string
 }
 
 func NewRandPicker(servers []string) RandPicker {
 	src := rand.NewSource(time.Now().UnixNano())
-	return *&RandPicker{servers: servers, rg: *rand.New(src)}
+	return RandPicker{state: &randState{servers: servers, rg: rand.New(src)}}
 }
 
 func (rp RandPicker) ChooseServers(name string, params list.List) (servers []string, err error) {
-	index := rp.rg.Intn(len(rp.servers))
-	return []string{rp.servers[index]}, nil
+	// rand.Rand isn't safe for concurrent use, so this takes the full lock
+	rp.state.mu.Lock()
+	defer rp.state.mu.Unlock()
+
+	if len(rp.state.servers) == 0 {
+		return nil, ErrNoServers
+	}
+	index := rp.state.rg.Intn(len(rp.state.servers))
+	return []string{rp.state.servers[index]}, nil
 }
 
 func (rp RandPicker) RegisterTimes(servers []string, times []float64) {
 	return
 }
+
+func (rp RandPicker) SetServers(servers []string) {
+	rp.state.mu.Lock()
+	rp.state.servers = servers
+	rp.state.mu.Unlock()
+}
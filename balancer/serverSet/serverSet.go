@@ -0,0 +1,324 @@
+package serverSet
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	ErrUnknownServer   = errors.New("serverSet: unknown server")
+	ErrDuplicateServer = errors.New("serverSet: server already in set")
+)
+
+/*
+ * Set keeps track of every backend server the balancer knows about and which
+ * of them are currently fit to receive traffic. Pickers registered with Watch
+ * are handed the list of available servers whenever it changes, so they never
+ * choose a server that has been marked down.
+ */
+type Set struct {
+	mu       sync.Mutex
+	servers  []string
+	down     map[string]bool
+	ejected  map[string]bool
+	draining map[string]bool
+	weights  map[string]int
+	pickers  []Watcher
+}
+
+// Anything that chooses from the servers, both ServerPicker and Picker do
+type Watcher interface {
+	SetServers(servers []string)
+}
+
+// Pickers that weigh servers, e.g. WeightedRoundRobin, are also sent weights
+type Weighter interface {
+	SetWeight(server string, weight int)
+}
+
+/*
+ * Watchers that keep state per server, e.g. outlier detection, are also sent
+ * every server in the set, available or not, so they can forget the ones
+ * that were removed. It is called with the set's lock held, so it must not
+ * call back into the set.
+ */
+type Pruner interface {
+	KeepServers(servers []string)
+}
+
+// What the set knows about one server
+type ServerState struct {
+	Server   string
+	Healthy  bool
+	Ejected  bool
+	Draining bool
+	Weight   int
+}
+
+func NewSet(servers []string) *Set {
+	s := &Set{
+		servers:  append([]string(nil), servers...),
+		down:     make(map[string]bool),
+		ejected:  make(map[string]bool),
+		draining: make(map[string]bool),
+		weights:  make(map[string]int),
+	}
+
+	return s
+}
+
+// Returns every server in the set, available or not
+func (s *Set) Servers() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.servers...)
+}
+
+// Returns the servers that pickers may currently choose from
+func (s *Set) Available() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.available()
+}
+
+func (s *Set) available() []string {
+	avail := make([]string, 0, len(s.servers))
+	for _, server := range s.servers {
+		if !s.down[server] && !s.ejected[server] && !s.draining[server] {
+			avail = append(avail, server)
+		}
+	}
+
+	return avail
+}
+
+// Registers a picker to be kept in sync with the available servers
+func (s *Set) Watch(picker Watcher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pickers = append(s.pickers, picker)
+	if w, ok := picker.(Weighter); ok {
+		for server, weight := range s.weights {
+			w.SetWeight(server, weight)
+		}
+	}
+	if p, ok := picker.(Pruner); ok {
+		p.KeepServers(append([]string(nil), s.servers...))
+	}
+	picker.SetServers(s.available())
+}
+
+// Stops keeping picker in sync, e.g. once a config reload replaced it
+func (s *Set) Unwatch(picker Watcher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, other := range s.pickers {
+		if other == picker {
+			s.pickers = append(s.pickers[:i], s.pickers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Returns the state of every server in the set
+func (s *Set) States() []ServerState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states := make([]ServerState, 0, len(s.servers))
+	for _, server := range s.servers {
+		states = append(states, s.state(server))
+	}
+
+	return states
+}
+
+// Returns the state of one server
+func (s *Set) State(server string) (ServerState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.has(server) {
+		return ServerState{}, ErrUnknownServer
+	}
+	return s.state(server), nil
+}
+
+func (s *Set) state(server string) ServerState {
+	weight, ok := s.weights[server]
+	if !ok {
+		weight = 1
+	}
+
+	return ServerState{
+		Server:   server,
+		Healthy:  !s.down[server],
+		Ejected:  s.ejected[server],
+		Draining: s.draining[server],
+		Weight:   weight,
+	}
+}
+
+func (s *Set) has(server string) bool {
+	for _, other := range s.servers {
+		if other == server {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+ * Adds a server, which is picked from right away. It starts out healthy,
+ * whatever was known about it before it was last removed.
+ */
+func (s *Set) Add(server string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.has(server) {
+		return ErrDuplicateServer
+	}
+	s.servers = append(s.servers, server)
+	s.forget(server)
+	s.prune()
+	s.notify()
+	return nil
+}
+
+/*
+ * Removes a server. Pickers stop choosing it at once, but requests already
+ * sent to it carry on until they finish.
+ */
+func (s *Set) Remove(server string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	servers := make([]string, 0, len(s.servers))
+	for _, other := range s.servers {
+		if other != server {
+			servers = append(servers, other)
+		}
+	}
+	if len(servers) == len(s.servers) {
+		return ErrUnknownServer
+	}
+	s.servers = servers
+	s.forget(server)
+	s.prune()
+	s.notify()
+	return nil
+}
+
+// Tells Pruners which servers are left after an add or remove, must hold s.mu
+func (s *Set) prune() {
+	for _, picker := range s.pickers {
+		if p, ok := picker.(Pruner); ok {
+			p.KeepServers(append([]string(nil), s.servers...))
+		}
+	}
+}
+
+// Drops the state kept for server, must hold s.mu
+func (s *Set) forget(server string) {
+	delete(s.down, server)
+	delete(s.ejected, server)
+	delete(s.draining, server)
+	delete(s.weights, server)
+}
+
+/*
+ * Marks a server as draining: it gets no new requests but stays in the set,
+ * and keeps being health checked, until it is removed or undrained.
+ */
+func (s *Set) SetDraining(server string, draining bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.has(server) {
+		return ErrUnknownServer
+	}
+	if s.draining[server] == draining {
+		return nil
+	}
+	if draining {
+		s.draining[server] = true
+	} else {
+		delete(s.draining, server)
+	}
+	s.notify()
+	return nil
+}
+
+/*
+ * Sets the weight of a server for pickers that are Weighters; other pickers
+ * ignore it.
+ */
+func (s *Set) SetWeight(server string, weight int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.has(server) {
+		return ErrUnknownServer
+	}
+	s.weights[server] = weight
+	for _, picker := range s.pickers {
+		if w, ok := picker.(Weighter); ok {
+			w.SetWeight(server, weight)
+		}
+	}
+	return nil
+}
+
+/*
+ * Marks a server as passing or failing its health checks. Servers start out
+ * healthy so traffic can flow before the first check completes. Servers not
+ * in the set are ignored, e.g. a check that finished after a removal.
+ */
+func (s *Set) SetHealthy(server string, healthy bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.has(server) || s.down[server] == !healthy {
+		return
+	}
+	if healthy {
+		delete(s.down, server)
+	} else {
+		s.down[server] = true
+	}
+	s.notify()
+}
+
+/*
+ * Marks a server as ejected by outlier detection. Ejection is tracked apart
+ * from health so a server has to pass both before it is used again. Servers
+ * not in the set are ignored.
+ */
+func (s *Set) SetEjected(server string, ejected bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.has(server) || s.ejected[server] == ejected {
+		return
+	}
+	if ejected {
+		s.ejected[server] = true
+	} else {
+		delete(s.ejected, server)
+	}
+	s.notify()
+}
+
+// Pushes the available servers to every picker, must hold s.mu
+func (s *Set) notify() {
+	avail := s.available()
+	for _, picker := range s.pickers {
+		picker.SetServers(avail)
+	}
+}
@@ -0,0 +1,34 @@
+package balancer
+
+import (
+	"github.com/open-lambda/load-balancer/balancer/serverPick"
+)
+
+// The parts of a LoadBalancer that can be changed while it runs
+type Settings struct {
+	Picker serverPick.Picker
+	// Optional, sends slow idempotent requests to more than one server
+	Hedging *HedgePolicy
+	// Optional, retries failed unary requests on another server
+	Retries *RetryPolicy
+	// Optional, default and maximum request timeouts
+	Timeouts *TimeoutPolicy
+}
+
+// Returns the settings new requests should use
+func (lb *LoadBalancer) settings() *Settings {
+	if cfg, ok := lb.live.Load().(*Settings); ok {
+		return cfg
+	}
+	return &lb.Settings
+}
+
+/*
+ * Replaces the picker and request policies of a running balancer. Requests
+ * that have started keep the settings they started with; client connections
+ * aren't touched. The embedded Settings are only read until the first call,
+ * so don't change them directly once Run has been called.
+ */
+func (lb *LoadBalancer) Reconfigure(cfg Settings) {
+	lb.live.Store(&cfg)
+}
@@ -0,0 +1,146 @@
+package balancer
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/transport"
+)
+
+// Returned by Run once Shutdown has been called
+var ErrShutdown = errors.New("balancer: shut down")
+
+// A client connection and the number of its streams still being forwarded
+type trackedConn struct {
+	st     transport.ServerTransport
+	active int
+}
+
+/*
+ * Bookkeeping for Shutdown: the listeners to close and every client connection
+ * that has to be drained. The zero value is ready to use.
+ */
+type connTracker struct {
+	mu       sync.Mutex
+	shutdown bool
+	done     chan struct{}
+	lis      []net.Listener
+	conns    map[*trackedConn]bool
+	wg       sync.WaitGroup
+}
+
+// Returns a channel that is closed once shutdown starts, must hold ct.mu
+func (ct *connTracker) doneChan() chan struct{} {
+	if ct.done == nil {
+		ct.done = make(chan struct{})
+	}
+	return ct.done
+}
+
+func (ct *connTracker) shuttingDown() <-chan struct{} {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	return ct.doneChan()
+}
+
+// Registers a listener, false if the balancer is already shut down
+func (ct *connTracker) addListener(lis net.Listener) bool {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	if ct.shutdown {
+		return false
+	}
+	ct.lis = append(ct.lis, lis)
+	return true
+}
+
+// Registers a client connection, false if the balancer is shutting down
+func (ct *connTracker) add(c *trackedConn) bool {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	if ct.shutdown {
+		return false
+	}
+	if ct.conns == nil {
+		ct.conns = make(map[*trackedConn]bool)
+	}
+	ct.conns[c] = true
+	ct.wg.Add(1)
+	return true
+}
+
+func (ct *connTracker) remove(c *trackedConn) {
+	ct.mu.Lock()
+	delete(ct.conns, c)
+	ct.mu.Unlock()
+	ct.wg.Done()
+}
+
+func (ct *connTracker) streamStarted(c *trackedConn) {
+	ct.mu.Lock()
+	c.active++
+	ct.mu.Unlock()
+}
+
+// Closes draining connections once their last stream is done
+func (ct *connTracker) streamDone(c *trackedConn) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	c.active--
+	if ct.shutdown && c.active == 0 {
+		c.st.Close()
+	}
+}
+
+/*
+ * Stops accepting connections and sends GOAWAY on every client connection so
+ * clients open no new streams. Connections are closed as their in-flight
+ * streams finish, then the connections to the backends. If ctx expires first,
+ * the remaining connections are closed anyway and ctx's error is returned.
+ */
+func (lb *LoadBalancer) Shutdown(ctx context.Context) error {
+	ct := &lb.tracker
+
+	ct.mu.Lock()
+	if !ct.shutdown {
+		ct.shutdown = true
+		close(ct.doneChan())
+		for _, lis := range ct.lis {
+			lis.Close()
+		}
+		for c := range ct.conns {
+			c.st.Drain()
+			if c.active == 0 {
+				c.st.Close()
+			}
+		}
+	}
+	ct.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		ct.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		lb.backends().close(ctx)
+		return nil
+	case <-ctx.Done():
+		ct.mu.Lock()
+		for c := range ct.conns {
+			c.st.Close()
+		}
+		ct.mu.Unlock()
+		<-drained
+		lb.backends().close(ctx)
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,126 @@
+package balancer
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestShutdownDrains(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	e := newTestEnv(newTestPicker("a"), map[string]*testBackend{
+		"a": newTestBackend(func(ctx context.Context, req []byte) ([]byte, error) {
+			started <- struct{}{}
+			<-release
+			return echo("a")(ctx, req)
+		}),
+	})
+	defer e.close()
+	cc := e.client(t)
+	defer cc.Close()
+
+	type result struct {
+		resp string
+		err  error
+	}
+	results := make(chan result, 1)
+	go func() {
+		resp, err := call(context.Background(), cc, "hello")
+		results <- result{resp, err}
+	}()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request never reached the backend")
+	}
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- e.lb.Shutdown(context.Background())
+	}()
+	if err := e.runErr(t); err != ErrShutdown {
+		t.Errorf("Run returned %v, want ErrShutdown", err)
+	}
+
+	// No new clients get in
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if conn, err := e.lis.dial(ctx, "balancer"); err == nil {
+		conn.Close()
+		t.Errorf("connected after Shutdown")
+	}
+
+	// But the request in flight is waited for
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned %v with a request in flight", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	res := <-results
+	if res.err != nil || res.resp != "a:hello" {
+		t.Errorf("got %q, %v, want %q", res.resp, res.err, "a:hello")
+	}
+	select {
+	case err := <-shutdown:
+		if err != nil {
+			t.Errorf("Shutdown returned %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Shutdown still waiting after the last request finished")
+	}
+}
+
+func TestShutdownTimesOut(t *testing.T) {
+	cancelled := make(chan struct{})
+	e := newTestEnv(newTestPicker("a"), map[string]*testBackend{
+		"a": newTestBackend(hang(cancelled)),
+	})
+	defer e.close()
+	cc := e.client(t)
+	defer cc.Close()
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := call(context.Background(), cc, "hello")
+		errs <- err
+	}()
+
+	// Give the request time to reach the backend
+	time.Sleep(50 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := e.lb.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Shutdown returned %v, want DeadlineExceeded", err)
+	}
+
+	// Requests still going are cut off, on both sides
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Errorf("request succeeded after a forced shutdown")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("request still going after a forced shutdown")
+	}
+	waitClosed(t, cancelled, "the backend to see the request cancelled")
+}
+
+func TestShutdownBeforeRun(t *testing.T) {
+	lis := newPipeListener()
+	lb := &LoadBalancer{}
+	lb.InitPicker("pipe", newTestPicker("a"), 1, WithListener(lis))
+
+	if err := lb.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := lb.Run(); err != ErrShutdown {
+		t.Errorf("Run returned %v, want ErrShutdown", err)
+	}
+	// Run still closes the listener it was given
+	if _, err := lis.Accept(); err == nil {
+		t.Errorf("listener left open")
+	}
+}
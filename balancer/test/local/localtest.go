@@ -8,7 +8,10 @@ import (
 	"time"
 
 	"github.com/open-lambda/load-balancer/balancer"
+	"github.com/open-lambda/load-balancer/balancer/healthCheck"
+	"github.com/open-lambda/load-balancer/balancer/outlierDetect"
 	"github.com/open-lambda/load-balancer/balancer/serverPick"
+	"github.com/open-lambda/load-balancer/balancer/serverSet"
 	"github.com/open-lambda/load-balancer/balancer/test/client"
 	"github.com/open-lambda/load-balancer/balancer/test/server"
 )
@@ -42,9 +45,18 @@ func main() {
 	}
 
 	chooser := serverPick.NewFirstTwo(conf.Servers)
+	set := serverSet.NewSet(conf.Servers)
+	set.Watch(chooser)
+	checker := healthCheck.NewChecker(set, healthCheck.DefaultConfig)
+	go checker.Run()
+	detector := outlierDetect.NewDetector(set, outlierDetect.DefaultConfig)
+	go detector.Run()
 	lb := new(balancer.LoadBalancer)
 	lb.Init(conf.LBAddr, chooser, 5)
-	go lb.Run()
+	lb.Outliers = detector
+	go func() {
+		log.Fatal(lb.Run())
+	}()
 	time.Sleep(time.Second)
 	for i := 0; ; i++ {
 		fmt.Printf("Client's been run %v time(s)\n", i)
@@ -1,42 +1,46 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/open-lambda/load-balancer/balancer"
-	"github.com/open-lambda/load-balancer/balancer/serverPick"
+	"github.com/open-lambda/load-balancer/balancer/config"
+	"golang.org/x/net/context"
 )
 
-type Config struct {
-	Servers []string
-	LBPort  string
-}
+const DRAIN_TIMEOUT = 30 * time.Second
+
+// How often balancer.conf is checked for changes
+const CONFIG_POLL = 5 * time.Second
 
-func readConfig(filename string) *Config {
-	fd, err := os.Open(filename)
+func main() {
+	runner, err := config.NewRunner("balancer.conf")
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	decoder := json.NewDecoder(fd)
-	conf := Config{}
-
-	err = decoder.Decode(&conf)
-	if err != nil {
-		log.Fatalf("could not decode config file: %v", err)
+	go runner.Watch(CONFIG_POLL)
+
+	// Drain connections on SIGTERM so deploys don't drop requests
+	drained := make(chan struct{})
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		<-sigs
+		log.Printf("shutting down, draining connections for up to %v", DRAIN_TIMEOUT)
+		ctx, cancel := context.WithTimeout(context.Background(), DRAIN_TIMEOUT)
+		defer cancel()
+		if err := runner.Shutdown(ctx); err != nil {
+			log.Printf("closed connections that didn't drain in time: %v", err)
+		}
+		close(drained)
+	}()
+
+	if err := runner.Run(); err != balancer.ErrShutdown {
+		log.Fatal(err)
 	}
-
-	return &conf
-}
-
-func main() {
-	conf := readConfig("balancer.conf")
-	chooser := serverPick.NewFirstTwo(conf.Servers)
-
-	lb := new(balancer.LoadBalancer)
-	lb.Init(fmt.Sprintf(":%s", conf.LBPort), chooser, conf.Consumers)
-	lb.Run()
+	<-drained
 }
@@ -7,6 +7,8 @@ import (
 
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 
 	pb "google.golang.org/grpc/examples/helloworld/helloworld"
 )
@@ -27,5 +29,11 @@ func RunServer(address string) {
 	}
 	s := grpc.NewServer()
 	pb.RegisterGreeterServer(s, &server{})
+
+	// Lets the balancer's health checker see this server as up
+	hs := health.NewHealthServer()
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(s, hs)
+
 	s.Serve(lis)
 }